@@ -0,0 +1,68 @@
+package crl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/crl"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+// A Handler accepts a list of revoked certificates and returns a CRL
+// signed by the CA.
+type Handler struct {
+	signer crl.Signer
+}
+
+// NewHandlerFromSigner returns a new CRL handler that signs CRLs with
+// s. The signer must be able to sign CRLs, i.e. it must hold the CA's
+// private key rather than forwarding requests to a remote CFSSL.
+func NewHandlerFromSigner(s signer.Signer) (http.Handler, error) {
+	crlSigner, ok := s.(crl.Signer)
+	if !ok {
+		return nil, errors.New(errors.PolicyError, errors.InvalidRequest)
+	}
+
+	return &api.HTTPHandler{
+		Handler: &Handler{
+			signer: crlSigner,
+		},
+		Method: "POST",
+	}, nil
+}
+
+// Handle responds to requests for a new CRL. The request body is a
+// JSON-encoded crl.Request; the result contains the PEM-encoded CRL.
+func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
+	log.Info("CRL request received")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Warningf("failed to read request body: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	r.Body.Close()
+
+	var req crl.Request
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		log.Warningf("failed to unmarshal request: %v", err)
+		return errors.NewBadRequestString("Unable to parse CRL request")
+	}
+
+	// Problems with the request come back as cferr errors, which are
+	// answered with 400; a failure to sign is the server's, and is
+	// answered with 500.
+	der, err := h.signer.SignCRL(req)
+	if err != nil {
+		log.Warningf("failed to generate CRL: %v", err)
+		return err
+	}
+
+	result := map[string]string{"crl": string(crl.EncodePEM(der))}
+	return api.SendResponse(w, result)
+}
@@ -0,0 +1,149 @@
+package crl
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/crl"
+	"github.com/cloudflare/cfssl/signer/local"
+	"github.com/cloudflare/cfssl/signer/remote"
+)
+
+const (
+	testCaFile    = "../../crl/testdata/ca.pem"
+	testCaKeyFile = "../../crl/testdata/ca-key.pem"
+)
+
+func newTestHandler(t *testing.T) http.Handler {
+	s, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewHandlerFromSigner(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestNewHandlerFromRemoteSigner(t *testing.T) {
+	policy := &config.Signing{
+		Profiles: map[string]*config.SigningProfile{},
+		Default:  config.DefaultConfig(),
+	}
+	policy.Default.RemoteName = "remote"
+	policy.Default.RemoteServer = "127.0.0.1:8888"
+
+	s, err := remote.NewSigner(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewHandlerFromSigner(s); err == nil {
+		t.Fatal("remote signer should not be able to sign CRLs")
+	}
+}
+
+func TestCRLHandler(t *testing.T) {
+	ts := httptest.NewServer(newTestHandler(t))
+	defer ts.Close()
+
+	req := crl.Request{
+		RevokedCertificates: []crl.RevokedCertificate{{Serial: "1", Reason: 1}},
+		Number:              3,
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.Status)
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	var response api.Response
+	if err = json.Unmarshal(respBody, &response); err != nil {
+		t.Fatal(err)
+	}
+	result := response.Result.(map[string]interface{})
+
+	block, _ := pem.Decode([]byte(result["crl"].(string)))
+	if block == nil {
+		t.Fatal("response did not contain a PEM-encoded CRL")
+	}
+	parsed, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Number.Int64() != 3 || len(parsed.RevokedCertificateEntries) != 1 {
+		t.Fatal("unexpected CRL contents")
+	}
+}
+
+func TestCRLHandlerBadRequest(t *testing.T) {
+	ts := httptest.NewServer(newTestHandler(t))
+	defer ts.Close()
+
+	for _, body := range []string{
+		"not json",
+		`{"revoked_certificates": [{"serial": "xyz"}]}`,
+		`{"revoked_certificates": [{"serial": "1", "reason": 8}]}`,
+	} {
+		resp, err := http.Post(ts.URL, "application/json", bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected bad request for %q, got %s", body, resp.Status)
+		}
+	}
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatal(resp.Status)
+	}
+}
+
+// failingSigner is a CRL signer whose key is unavailable.
+type failingSigner struct{}
+
+func (failingSigner) SignCRL(req crl.Request) ([]byte, error) {
+	return nil, errors.New("key is unavailable")
+}
+
+func TestCRLHandlerSignerFailure(t *testing.T) {
+	ts := httptest.NewServer(&api.HTTPHandler{Handler: &Handler{signer: failingSigner{}}, Method: "POST"})
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "application/json", bytes.NewReader([]byte(`{}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected a server error, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,157 @@
+package revoke
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/ocsp"
+)
+
+// A Handler accepts authenticated requests to revoke a certificate,
+// records the revocation in the certificate store, and stores and
+// returns a freshly signed OCSP response for the certificate.
+type Handler struct {
+	dbAccessor certdb.Accessor
+	ocspSigner ocsp.Signer
+	provider   auth.Provider
+}
+
+// NewHandler returns a new revocation handler. Requests are verified
+// with provider, which is required: revocation is never available
+// unauthenticated. The OCSP signer is required too, so that every
+// revocation is published in a fresh OCSP response.
+func NewHandler(dbAccessor certdb.Accessor, ocspSigner ocsp.Signer, provider auth.Provider) (http.Handler, error) {
+	if dbAccessor == nil || ocspSigner == nil || provider == nil {
+		return nil, errors.New(errors.PolicyError, errors.InvalidPolicy)
+	}
+
+	return &api.HTTPHandler{
+		Handler: &Handler{
+			dbAccessor: dbAccessor,
+			ocspSigner: ocspSigner,
+			provider:   provider,
+		},
+		Method: "POST",
+	}, nil
+}
+
+// This type is meant to be unmarshalled from JSON so that there can be a
+// reason string rather than a reason code.
+type jsonRevokeRequest struct {
+	Serial string `json:"serial"`
+	AKI    string `json:"authority_key_id"`
+	Reason string `json:"reason"`
+}
+
+// Handle responds to revocation requests. The request body is an
+// auth.AuthenticatedRequest wrapping a JSON object with the serial
+// number and authority key identifier of the certificate, and the
+// reason for revocation.
+func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
+	log.Info("revocation request received")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Warningf("failed to read request body: %v", err)
+		return errors.NewBadRequest(err)
+	}
+	r.Body.Close()
+
+	var aReq auth.AuthenticatedRequest
+	err = json.Unmarshal(body, &aReq)
+	if err != nil {
+		log.Warningf("failed to unmarshal authenticated request: %v", err)
+		return errors.NewBadRequest(err)
+	}
+
+	if !h.provider.Verify(&aReq) {
+		log.Warning("received authenticated request with invalid token")
+		return errors.NewBadRequestString("invalid token")
+	}
+
+	var req jsonRevokeRequest
+	err = json.Unmarshal(aReq.Request, &req)
+	if err != nil {
+		log.Warningf("failed to unmarshal request from authenticated request: %v", err)
+		return errors.NewBadRequestString("Unable to parse revocation request")
+	}
+
+	if req.Serial == "" {
+		return errors.NewBadRequestMissingParameter("serial")
+	}
+	if req.AKI == "" {
+		return errors.NewBadRequestMissingParameter("authority_key_id")
+	}
+
+	reasonCode, err := ocsp.ReasonStringToCode(req.Reason)
+	if err != nil {
+		log.Warningf("invalid revocation reason %q", req.Reason)
+		return err
+	}
+
+	err = h.dbAccessor.RevokeCertificate(req.Serial, req.AKI, reasonCode)
+	if cfErr, ok := err.(*errors.Error); ok && cfErr.ErrorCode == int(errors.CertStoreError)+int(errors.AlreadyRevoked) {
+		// The first revocation stands, but its OCSP response is
+		// signed again: a previous request may have revoked the
+		// certificate and then failed to sign one.
+		log.Warningf("certificate %s (aki %s) is already revoked; signing its OCSP response again", req.Serial, req.AKI)
+	} else if err != nil {
+		log.Warningf("failed to revoke certificate %s: %v", req.Serial, err)
+		return err
+	} else {
+		log.Infof("revoked certificate %s (aki %s) with reason %d", req.Serial, req.AKI, reasonCode)
+	}
+
+	resp, err := h.signOCSPResponse(req.Serial, req.AKI)
+	if err != nil {
+		log.Errorf("failed to sign OCSP response for revoked certificate: %v", err)
+		return err
+	}
+
+	result := map[string]string{
+		"ocsp_response": base64.StdEncoding.EncodeToString(resp),
+	}
+	return api.SendResponse(w, result)
+}
+
+// signOCSPResponse signs a new OCSP response reflecting the stored
+// status of a certificate, and stores it so that it is served by
+// responders backed by the certificate store.
+func (h *Handler) signOCSPResponse(serial, aki string) ([]byte, error) {
+	crs, err := h.dbAccessor.GetCertificate(serial, aki)
+	if err != nil {
+		return nil, err
+	}
+	if len(crs) != 1 {
+		return nil, errors.New(errors.CertStoreError, errors.RecordNotFound)
+	}
+
+	signReq, err := ocsp.NewSignRequestFromRecord(crs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := h.ocspSigner.Sign(signReq)
+	if err != nil {
+		return nil, err
+	}
+
+	rr, err := ocsp.NewOCSPRecord(aki, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.dbAccessor.UpsertOCSP(rr)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,273 @@
+package revoke
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/certdb"
+	certsql "github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/ocsp"
+
+	goocsp "golang.org/x/crypto/ocsp"
+)
+
+const (
+	testCaFile    = "../../ocsp/testdata/ca.pem"
+	testCaKeyFile = "../../ocsp/testdata/ca-key.pem"
+	testCertFile  = "../../ocsp/testdata/cert.pem"
+	testAuthKey   = "0123456789ABCDEF0123456789ABCDEF"
+)
+
+func prepRecord(t *testing.T, dba certdb.Accessor) certdb.CertificateRecord {
+	certPEM, err := ioutil.ReadFile(testCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr := certdb.CertificateRecord{
+		Serial: cert.SerialNumber.String(),
+		AKI:    hex.EncodeToString(cert.AuthorityKeyId),
+		Status: certdb.StatusGood,
+		Expiry: cert.NotAfter,
+		PEM:    string(certPEM),
+	}
+	if err = dba.InsertCertificate(cr); err != nil {
+		t.Fatal(err)
+	}
+	return cr
+}
+
+func newTestHandler(t *testing.T, dba certdb.Accessor, provider auth.Provider) http.Handler {
+	signer, err := ocsp.NewSignerFromFile(testCaFile, testCaFile, testCaKeyFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewHandler(dba, signer, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func newRevokeRequest(t *testing.T, provider auth.Provider, serial, aki, reason string) []byte {
+	req, err := json.Marshal(map[string]string{
+		"serial":           serial,
+		"authority_key_id": aki,
+		"reason":           reason,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := provider.Token(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(&auth.AuthenticatedRequest{Token: token, Request: req})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestNewHandler(t *testing.T) {
+	provider, err := auth.New(testAuthKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ocsp.NewSignerFromFile(testCaFile, testCaFile, testCaKeyFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewHandler(certsql.NewAccessor(testdb.SQLiteDB()), signer, nil); err == nil {
+		t.Fatal("revocation handler created without an authentication provider")
+	}
+
+	if _, err = NewHandler(nil, signer, provider); err == nil {
+		t.Fatal("revocation handler created without a certificate store")
+	}
+
+	if _, err = NewHandler(certsql.NewAccessor(testdb.SQLiteDB()), nil, provider); err == nil {
+		t.Fatal("revocation handler created without an OCSP signer")
+	}
+
+	if _, err = NewHandler(certsql.NewAccessor(testdb.SQLiteDB()), signer, provider); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	provider, err := auth.New(testAuthKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dba := certsql.NewAccessor(testdb.SQLiteDB())
+	cr := prepRecord(t, dba)
+
+	ts := httptest.NewServer(newTestHandler(t, dba, provider))
+	defer ts.Close()
+
+	body := newRevokeRequest(t, provider, cr.Serial, cr.AKI, "keyCompromise")
+	resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", resp.StatusCode, respBody)
+	}
+
+	var response api.Response
+	if err = json.Unmarshal(respBody, &response); err != nil {
+		t.Fatal(err)
+	}
+	result := response.Result.(map[string]interface{})
+	der, err := base64.StdEncoding.DecodeString(result["ocsp_response"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ocspResp, err := goocsp.ParseResponse(der, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ocspResp.Status != goocsp.Revoked || ocspResp.RevocationReason != goocsp.KeyCompromise {
+		t.Fatalf("OCSP response does not reflect revocation: status %d, reason %d",
+			ocspResp.Status, ocspResp.RevocationReason)
+	}
+
+	crs, err := dba.GetCertificate(cr.Serial, cr.AKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crs) != 1 || crs[0].Status != certdb.StatusRevoked {
+		t.Fatal("certificate was not marked revoked in the store")
+	}
+
+	rrs, err := dba.GetOCSP(cr.Serial, cr.AKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 1 || !bytes.Equal(rrs[0].Body, der) {
+		t.Fatal("OCSP response was not stored")
+	}
+
+	// As if signing had failed after the first revocation, the
+	// stored OCSP response is stale. Revoking the certificate again
+	// leaves the first revocation as it was, but replaces the stale
+	// response with a fresh one.
+	err = dba.UpsertOCSP(certdb.OCSPRecord{Serial: cr.Serial, AKI: cr.AKI, Body: []byte("stale"), Expiry: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = newRevokeRequest(t, provider, cr.Serial, cr.AKI, "superseded")
+	resp, err = http.Post(ts.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	respBody, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d for a second revocation: %s", resp.StatusCode, respBody)
+	}
+	response = api.Response{}
+	if err = json.Unmarshal(respBody, &response); err != nil {
+		t.Fatal(err)
+	}
+	result = response.Result.(map[string]interface{})
+	if der, err = base64.StdEncoding.DecodeString(result["ocsp_response"].(string)); err != nil {
+		t.Fatal(err)
+	}
+	if ocspResp, err = goocsp.ParseResponse(der, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ocspResp.Status != goocsp.Revoked || ocspResp.RevocationReason != goocsp.KeyCompromise {
+		t.Fatalf("OCSP response does not reflect the first revocation: status %d, reason %d",
+			ocspResp.Status, ocspResp.RevocationReason)
+	}
+
+	again, err := dba.GetCertificate(cr.Serial, cr.AKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[0].Reason != crs[0].Reason || !again[0].RevokedAt.Equal(crs[0].RevokedAt) {
+		t.Fatalf("second revocation changed the record: %+v", again[0])
+	}
+	if rrs, err = dba.GetOCSP(cr.Serial, cr.AKI); err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 1 || !bytes.Equal(rrs[0].Body, der) {
+		t.Fatal("second revocation did not store a fresh OCSP response")
+	}
+}
+
+func TestRevokeBadRequests(t *testing.T) {
+	provider, err := auth.New(testAuthKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dba := certsql.NewAccessor(testdb.SQLiteDB())
+	cr := prepRecord(t, dba)
+
+	ts := httptest.NewServer(newTestHandler(t, dba, provider))
+	defer ts.Close()
+
+	otherProvider, err := auth.New("FEDCBA9876543210FEDCBA9876543210", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bodies = [][]byte{
+		// invalid token
+		newRevokeRequest(t, otherProvider, cr.Serial, cr.AKI, ""),
+		// missing serial
+		newRevokeRequest(t, provider, "", cr.AKI, ""),
+		// missing AKI
+		newRevokeRequest(t, provider, cr.Serial, "", ""),
+		// bad reason
+		newRevokeRequest(t, provider, cr.Serial, cr.AKI, "notAReason"),
+		// unknown certificate
+		newRevokeRequest(t, provider, "1", cr.AKI, ""),
+		// malformed request
+		[]byte("{"),
+	}
+
+	for i, body := range bodies {
+		resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("request %d: expected status %d, got %d", i, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+
+	crs, err := dba.GetCertificate(cr.Serial, cr.AKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crs) != 1 || crs[0].Status != certdb.StatusGood {
+		t.Fatal("certificate was revoked by a bad request")
+	}
+}
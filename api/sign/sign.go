@@ -142,6 +142,7 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 	if signReq.Hosts == nil {
 		return errors.NewBadRequestString("missing parameter 'hostname' or 'hosts'")
 	}
+	signReq.Requester = r.RemoteAddr
 
 	if req.Request == "" {
 		return errors.NewBadRequestString("missing parameter 'certificate_request'")
@@ -292,6 +293,7 @@ func (h *AuthHandler) Handle(w http.ResponseWriter, r *http.Request) error {
 	if signReq.Hosts == nil {
 		return errors.NewBadRequestString("missing parameter 'hostname' or 'hosts'")
 	}
+	signReq.Requester = r.RemoteAddr
 
 	if signReq.Request == "" {
 		return errors.NewBadRequestString("missing parameter 'certificate_request'")
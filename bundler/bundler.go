@@ -4,16 +4,18 @@ package bundler
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -23,6 +25,7 @@ import (
 	"github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/revoke"
 	"github.com/cloudflare/cfssl/ubiquity"
 )
 
@@ -53,15 +56,24 @@ const (
 	untrustedWarningStub     = "The bundle may not be trusted by the following platform(s):"
 	ubiquityWarning          = "The bundle trust ubiquity is not guaranteed: No platform metadata found."
 	deprecateSHA1WarningStub = "Due to SHA-1 deprecation, the bundle may not be trusted by the following platform(s):"
+	revokedChainWarningStub  = "A chain was passed over because of revocation: "
+	uncheckedWarningStub     = "The revocation status of the bundle could not be checked: "
 )
 
 // A Bundler contains the certificate pools for producing certificate
 // bundles. It contains any intermediates and root certificates that
-// should be used.
+// should be used. Intermediates named in AIA extensions are fetched
+// with Fetcher, or with helpers.DefaultFetcher if it is nil. If
+// RevocationChecker is not nil, the certificates of each candidate
+// chain are checked for revocation with it, each against its issuer
+// in the chain, and chains holding a revoked certificate are passed
+// over.
 type Bundler struct {
-	RootPool         *x509.CertPool
-	IntermediatePool *x509.CertPool
-	KnownIssuers     map[string]bool
+	RootPool          *x509.CertPool
+	IntermediatePool  *x509.CertPool
+	KnownIssuers      map[string]bool
+	Fetcher           helpers.Fetcher
+	RevocationChecker *revoke.Checker
 }
 
 // NewBundler creates a new Bundler from the files passed in; these
@@ -265,6 +277,13 @@ func (b *Bundler) BundleFromRemote(serverName, ip string, flavor BundleFlavor) (
 	return bundle, err
 }
 
+func (b *Bundler) fetcher() helpers.Fetcher {
+	if b.Fetcher == nil {
+		return helpers.DefaultFetcher
+	}
+	return b.Fetcher
+}
+
 type fetchedIntermediate struct {
 	Cert *x509.Certificate
 	Name string
@@ -273,18 +292,18 @@ type fetchedIntermediate struct {
 // fetchRemoteCertificate retrieves a single URL pointing to a certificate
 // and attempts to first parse it as a DER-encoded certificate; if
 // this fails, it attempts to decode it as a PEM-encoded certificate.
-func fetchRemoteCertificate(certURL string) (fi *fetchedIntermediate, err error) {
+func fetchRemoteCertificate(ctx context.Context, f helpers.Fetcher, certURL string) (fi *fetchedIntermediate, err error) {
 	log.Debugf("fetching remote certificate: %s", certURL)
-	var resp *http.Response
-	resp, err = http.Get(certURL)
+	var resp io.ReadCloser
+	resp, err = f.Get(ctx, certURL)
 	if err != nil {
 		log.Debugf("failed HTTP get: %v", err)
 		return
 	}
 
-	defer resp.Body.Close()
+	defer resp.Close()
 	var certData []byte
-	certData, err = ioutil.ReadAll(resp.Body)
+	certData, err = ioutil.ReadAll(resp)
 	if err != nil {
 		log.Debugf("failed to read response body: %v", err)
 		return
@@ -469,7 +488,7 @@ func (b *Bundler) fetchIntermediates(certs []*x509.Certificate) (err error) {
 				log.Debugf("url %s has been seen", url)
 				continue
 			}
-			crt, err := fetchRemoteCertificate(url)
+			crt, err := fetchRemoteCertificate(context.Background(), b.fetcher(), url)
 			if err != nil {
 				continue
 			} else if seen[string(crt.Cert.Signature)] {
@@ -492,7 +511,7 @@ func (b *Bundler) fetchIntermediates(certs []*x509.Certificate) (err error) {
 
 // Bundle takes an X509 certificate (already in the
 // Certificate structure), a private key as crypto.Signer in one of the appropriate
-// formats (i.e. *rsa.PrivateKey or *ecdsa.PrivateKey, or even a opaque key), using them to
+// formats (i.e. *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey, or even a opaque key), using them to
 // build a certificate bundle.
 func (b *Bundler) Bundle(certs []*x509.Certificate, key crypto.Signer, flavor BundleFlavor) (*Bundle, error) {
 	log.Infof("bundling certificate for %+v", certs[0].Subject)
@@ -529,6 +548,14 @@ func (b *Bundler) Bundle(certs []*x509.Certificate, key crypto.Signer, flavor Bu
 			if cert.PublicKey.(*ecdsa.PublicKey).X.Cmp(ecdsaPublicKey.X) != 0 {
 				return nil, errors.New(errors.PrivateKeyError, errors.KeyMismatch)
 			}
+		case cert.PublicKeyAlgorithm == x509.Ed25519:
+			var ed25519PublicKey ed25519.PublicKey
+			if ed25519PublicKey, ok = key.Public().(ed25519.PublicKey); !ok {
+				return nil, errors.New(errors.PrivateKeyError, errors.KeyMismatch)
+			}
+			if !ed25519PublicKey.Equal(cert.PublicKey) {
+				return nil, errors.New(errors.PrivateKeyError, errors.KeyMismatch)
+			}
 		default:
 			return nil, errors.New(errors.PrivateKeyError, errors.NotRSAOrECC)
 		}
@@ -536,6 +563,7 @@ func (b *Bundler) Bundle(certs []*x509.Certificate, key crypto.Signer, flavor Bu
 		switch {
 		case cert.PublicKeyAlgorithm == x509.RSA:
 		case cert.PublicKeyAlgorithm == x509.ECDSA:
+		case cert.PublicKeyAlgorithm == x509.Ed25519:
 		default:
 			return nil, errors.New(errors.PrivateKeyError, errors.NotRSAOrECC)
 		}
@@ -600,6 +628,14 @@ func (b *Bundler) Bundle(certs []*x509.Certificate, key crypto.Signer, flavor Bu
 		matchingChains = ubiquitousChains(chains)
 	}
 
+	var revocationMessages []string
+	if b.RevocationChecker != nil {
+		matchingChains, revocationMessages, err = b.unrevokedChains(matchingChains)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	bundle.Chain = matchingChains[0]
 	// Include at least one intermediate if the leaf has enabled OCSP and is not CA.
 	if bundle.Cert.OCSPServer != nil && !bundle.Cert.IsCA && len(bundle.Chain) <= 2 {
@@ -610,7 +646,7 @@ func (b *Bundler) Bundle(certs []*x509.Certificate, key crypto.Signer, flavor Bu
 	}
 
 	statusCode := int(errors.Success)
-	var messages []string
+	messages := revocationMessages
 	// Check if bundle is expiring.
 	expiringCerts := checkExpiringCerts(bundle.Chain)
 	bundle.Expires = helpers.ExpiryTime(bundle.Chain)
@@ -656,6 +692,39 @@ func (b *Bundler) Bundle(certs []*x509.Certificate, key crypto.Signer, flavor Bu
 	return bundle, nil
 }
 
+// unrevokedChains returns the chains in which the bundler's revocation
+// checker finds no revoked certificate, in their original order, along
+// with status messages explaining why chains were passed over and
+// whether the first chain kept could be checked. It fails if every
+// chain holds a revoked certificate.
+func (b *Bundler) unrevokedChains(chains [][]*x509.Certificate) ([][]*x509.Certificate, []string, error) {
+	var kept [][]*x509.Certificate
+	var messages []string
+	var rejected revoke.Result
+	for _, chain := range chains {
+		result := b.RevocationChecker.CheckChain(context.Background(), chain)
+		if result.Revoked {
+			log.Infof("passing over chain: %s", result)
+			messages = append(messages, revokedChainWarningStub+result.String())
+			rejected = result
+			continue
+		}
+		if !result.OK {
+			log.Warningf("revocation status of chain could not be checked: %s", result)
+			if len(kept) == 0 {
+				messages = append(messages, uncheckedWarningStub+result.String())
+			}
+		}
+		kept = append(kept, chain)
+	}
+
+	if len(kept) == 0 {
+		return nil, nil, errors.Wrap(errors.CertificateError, errors.VerifyFailed,
+			fmt.Errorf("no chain without a revoked certificate: %s", rejected))
+	}
+	return kept, messages, nil
+}
+
 // checkExpiringCerts returns indices of certs that are expiring within 30 days.
 func checkExpiringCerts(chain []*x509.Certificate) (expiringIntermediates []int) {
 	now := time.Now()
@@ -3,9 +3,17 @@ package bundler
 // This test file contains mostly tests on checking Bundle.Status when bundling under different circumstances.
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	goerrors "errors"
+	"io"
 	"io/ioutil"
+	"math/big"
 	"strings"
 	"testing"
 	"time"
@@ -13,6 +21,7 @@ import (
 	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/revoke"
 	"github.com/cloudflare/cfssl/signer"
 	"github.com/cloudflare/cfssl/signer/local"
 	"github.com/cloudflare/cfssl/ubiquity"
@@ -681,6 +690,123 @@ func readCert(filename string) *x509.Certificate {
 
 // newBundler is a helper function that returns a new Bundler. If it fails to do so,
 // it fails the test suite immediately.
+// crlFetcher serves a single CRL in place of the network.
+type crlFetcher struct {
+	url string
+	crl []byte
+}
+
+func (f crlFetcher) Get(ctx context.Context, url string) (io.ReadCloser, error) {
+	if url != f.url {
+		return nil, goerrors.New("not found: " + url)
+	}
+	return ioutil.NopCloser(bytes.NewReader(f.crl)), nil
+}
+
+func (f crlFetcher) Post(ctx context.Context, url, contentType string, body io.Reader) (io.ReadCloser, error) {
+	return nil, goerrors.New("POST not supported")
+}
+
+func TestBundleRevocationChecker(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Revocation Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const crlURL = "http://crl.example.com/ca.crl"
+	newLeaf := func(serial int64) *x509.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: "leaf.example.com"},
+			DNSNames:              []string{"leaf.example.com"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(24 * time.Hour),
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			CRLDistributionPoints: []string{crlURL},
+		}, ca, key.Public(), caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	good, revoked := newLeaf(2), newLeaf(3)
+
+	crl, err := ca.CreateCRL(rand.Reader, caKey, []pkix.RevokedCertificate{{
+		SerialNumber:   big.NewInt(3),
+		RevocationTime: time.Now().Add(-time.Minute),
+	}}, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &Bundler{
+		RootPool:         x509.NewCertPool(),
+		IntermediatePool: x509.NewCertPool(),
+		KnownIssuers:     map[string]bool{},
+	}
+	b.RootPool.AddCert(ca)
+
+	// Without a checker, revocation is not looked at.
+	if _, err = b.Bundle([]*x509.Certificate{revoked}, nil, Force); err != nil {
+		t.Fatal(err)
+	}
+
+	b.RevocationChecker = &revoke.Checker{Fetcher: crlFetcher{crlURL, crl}, CRLs: revoke.NewCRLCache()}
+	bundle, err := b.Bundle([]*x509.Certificate{good}, nil, Force)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range bundle.Status.Messages {
+		if strings.Contains(msg, "revocation") {
+			t.Fatalf("unexpected revocation message %q", msg)
+		}
+	}
+	if _, err = b.Bundle([]*x509.Certificate{revoked}, nil, Force); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Fatalf("a revoked certificate was bundled: %v", err)
+	}
+
+	// A CRL that can't be fetched doesn't stop the bundle, but the
+	// status says why its revocation status is unknown.
+	b.RevocationChecker = &revoke.Checker{Fetcher: crlFetcher{}, CRLs: revoke.NewCRLCache()}
+	if bundle, err = b.Bundle([]*x509.Certificate{good}, nil, Force); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, msg := range bundle.Status.Messages {
+		if strings.HasPrefix(msg, uncheckedWarningStub) && strings.Contains(msg, "CRL check failed") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("no revocation message in the status: %v", bundle.Status.Messages)
+	}
+}
+
 func newBundler(t *testing.T) (b *Bundler) {
 	b, err := NewBundler(testCaBundle, testIntCaBundle)
 	if err != nil {
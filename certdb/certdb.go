@@ -0,0 +1,54 @@
+// Package certdb defines the interface used by CFSSL to record the
+// certificates it issues and the OCSP responses signed for them, along
+// with the records kept for each.
+package certdb
+
+import (
+	"time"
+)
+
+// Status values recorded for a certificate.
+const (
+	StatusGood    = "good"
+	StatusRevoked = "revoked"
+)
+
+// CertificateRecord encodes a certificate and its metadata
+// that will be recorded in a certificate store.
+type CertificateRecord struct {
+	Serial    string
+	AKI       string
+	CALabel   string
+	Profile   string
+	Requester string
+	Status    string
+	Reason    int
+	Expiry    time.Time
+	RevokedAt time.Time
+	PEM       string
+}
+
+// OCSPRecord encodes an OCSP response for a certificate, along with
+// the response's nextUpdate time, that will be recorded in a
+// certificate store. The certificate is identified by its serial
+// number and authority key identifier, as in CertificateRecord.
+type OCSPRecord struct {
+	Serial string
+	AKI    string
+	Body   []byte
+	Expiry time.Time
+}
+
+// Accessor abstracts the CRUD of a certificate store; any storage
+// backend that implements it may be used by a signer to record the
+// certificates it issues.
+type Accessor interface {
+	InsertCertificate(cr CertificateRecord) error
+	GetCertificate(serial, aki string) ([]CertificateRecord, error)
+	GetUnexpiredCertificates() ([]CertificateRecord, error)
+	RevokeCertificate(serial, aki string, reasonCode int) error
+	InsertOCSP(rr OCSPRecord) error
+	GetOCSP(serial, aki string) ([]OCSPRecord, error)
+	GetUnexpiredOCSPs() ([]OCSPRecord, error)
+	UpsertOCSP(rr OCSPRecord) error
+}
@@ -0,0 +1,27 @@
+package dbconf
+
+import (
+	"testing"
+)
+
+func TestLoadFile(t *testing.T) {
+	cfg, err := LoadFile("testdata/db-config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DriverName != "sqlite3" || cfg.DataSourceName != "certs.db" {
+		t.Fatalf("unexpected configuration: %+v", cfg)
+	}
+
+	if _, err = LoadFile("testdata/bad-db-config.json"); err == nil {
+		t.Fatal("configuration without a data source should be rejected")
+	}
+
+	if _, err = LoadFile("testdata/missing.json"); err == nil {
+		t.Fatal("missing configuration file should be rejected")
+	}
+
+	if _, err = LoadFile(""); err == nil {
+		t.Fatal("empty path should be rejected")
+	}
+}
@@ -0,0 +1,337 @@
+// Package sql implements a certdb.Accessor on top of database/sql. It
+// uses '?' placeholders and is tested against SQLite; any driver using
+// the same bind variable syntax (such as MySQL) can be used.
+package sql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	cferr "github.com/cloudflare/cfssl/errors"
+)
+
+const (
+	insertSQL = `
+INSERT INTO certificates (serial_number, authority_key_identifier, ca_label, profile, requester, status, reason, expiry, revoked_at, pem)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+	selectSQL = `
+SELECT serial_number, authority_key_identifier, ca_label, profile, requester, status, reason, expiry, revoked_at, pem
+	FROM certificates`
+
+	selectBySerialAKISQL = selectSQL + `
+	WHERE (serial_number = ? AND authority_key_identifier = ?);`
+
+	selectUnexpiredSQL = selectSQL + `
+	WHERE ? < expiry;`
+
+	revokeSQL = `
+UPDATE certificates
+	SET status = ?, reason = ?, revoked_at = ?
+	WHERE (serial_number = ? AND authority_key_identifier = ? AND status != ?);`
+
+	insertOCSPSQL = `
+INSERT INTO ocsp_responses (serial_number, authority_key_identifier, body, expiry)
+	VALUES (?, ?, ?, ?);`
+
+	updateOCSPSQL = `
+UPDATE ocsp_responses
+	SET body = ?, expiry = ?
+	WHERE (serial_number = ? AND authority_key_identifier = ?);`
+
+	selectOCSPSQL = `
+SELECT serial_number, authority_key_identifier, body, expiry
+	FROM ocsp_responses`
+
+	selectOCSPBySerialAKISQL = selectOCSPSQL + `
+	WHERE (serial_number = ? AND authority_key_identifier = ?);`
+
+	selectUnexpiredOCSPSQL = selectOCSPSQL + `
+	WHERE ? < expiry;`
+
+	countOCSPBySerialAKISQL = `
+SELECT COUNT(*) FROM ocsp_responses
+	WHERE (serial_number = ? AND authority_key_identifier = ?);`
+)
+
+// Accessor implements certdb.Accessor using a database/sql handle.
+type Accessor struct {
+	db *sql.DB
+}
+
+func wrapCertStoreError(err error) error {
+	if err != nil {
+		return cferr.Wrap(cferr.CertStoreError, cferr.Unknown, err)
+	}
+	return nil
+}
+
+// NewAccessor returns a new Accessor backed by db.
+func NewAccessor(db *sql.DB) *Accessor {
+	return &Accessor{db: db}
+}
+
+func (d *Accessor) checkDB() error {
+	if d.db == nil {
+		return cferr.Wrap(cferr.CertStoreError, cferr.Unknown,
+			errors.New("no database handle set"))
+	}
+	return nil
+}
+
+// InsertCertificate puts a certdb.CertificateRecord into the db.
+func (d *Accessor) InsertCertificate(cr certdb.CertificateRecord) error {
+	err := d.checkDB()
+	if err != nil {
+		return err
+	}
+
+	res, err := d.db.Exec(insertSQL,
+		cr.Serial,
+		cr.AKI,
+		cr.CALabel,
+		cr.Profile,
+		cr.Requester,
+		cr.Status,
+		cr.Reason,
+		cr.Expiry.UTC(),
+		cr.RevokedAt.UTC(),
+		cr.PEM,
+	)
+	if err != nil {
+		return wrapCertStoreError(err)
+	}
+
+	numRowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return wrapCertStoreError(err)
+	}
+
+	if numRowsAffected != 1 {
+		return cferr.Wrap(cferr.CertStoreError, cferr.InsertionFailed,
+			errors.New("failed to insert the certificate record"))
+	}
+
+	return nil
+}
+
+// GetCertificate gets a certdb.CertificateRecord indexed by serial and
+// authority key identifier.
+func (d *Accessor) GetCertificate(serial, aki string) ([]certdb.CertificateRecord, error) {
+	err := d.checkDB()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.queryCertificates(selectBySerialAKISQL, serial, aki)
+}
+
+// GetUnexpiredCertificates gets all unexpired certificates from the db.
+func (d *Accessor) GetUnexpiredCertificates() ([]certdb.CertificateRecord, error) {
+	err := d.checkDB()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.queryCertificates(selectUnexpiredSQL, time.Now().UTC())
+}
+
+// RevokeCertificate marks the certificate identified by serial and
+// authority key identifier as revoked, recording the reason code and
+// the current time as the time of revocation. A certificate that is
+// already revoked keeps its first revocation, and an AlreadyRevoked
+// error is returned.
+func (d *Accessor) RevokeCertificate(serial, aki string, reasonCode int) error {
+	err := d.checkDB()
+	if err != nil {
+		return err
+	}
+
+	res, err := d.db.Exec(revokeSQL,
+		certdb.StatusRevoked,
+		reasonCode,
+		time.Now().UTC(),
+		serial,
+		aki,
+		certdb.StatusRevoked,
+	)
+	if err != nil {
+		return wrapCertStoreError(err)
+	}
+
+	numRowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return wrapCertStoreError(err)
+	}
+
+	if numRowsAffected == 0 {
+		// A revoked certificate keeps the time and reason of its
+		// first revocation, so tell that apart from a missing one.
+		crs, err := d.GetCertificate(serial, aki)
+		if err != nil {
+			return err
+		}
+		if len(crs) == 0 {
+			return cferr.Wrap(cferr.CertStoreError, cferr.RecordNotFound,
+				errors.New("failed to revoke the certificate: certificate not found"))
+		}
+		return cferr.Wrap(cferr.CertStoreError, cferr.AlreadyRevoked,
+			errors.New("failed to revoke the certificate: certificate is already revoked"))
+	}
+
+	return nil
+}
+
+func (d *Accessor) queryCertificates(query string, args ...interface{}) ([]certdb.CertificateRecord, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, wrapCertStoreError(err)
+	}
+	defer rows.Close()
+
+	var crs []certdb.CertificateRecord
+	for rows.Next() {
+		var cr certdb.CertificateRecord
+		var expiry, revokedAt time.Time
+		err = rows.Scan(
+			&cr.Serial,
+			&cr.AKI,
+			&cr.CALabel,
+			&cr.Profile,
+			&cr.Requester,
+			&cr.Status,
+			&cr.Reason,
+			&expiry,
+			&revokedAt,
+			&cr.PEM,
+		)
+		if err != nil {
+			return nil, wrapCertStoreError(err)
+		}
+		cr.Expiry = expiry.UTC()
+		cr.RevokedAt = revokedAt.UTC()
+		crs = append(crs, cr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, wrapCertStoreError(err)
+	}
+
+	return crs, nil
+}
+
+// InsertOCSP puts a certdb.OCSPRecord into the db.
+func (d *Accessor) InsertOCSP(rr certdb.OCSPRecord) error {
+	err := d.checkDB()
+	if err != nil {
+		return err
+	}
+
+	res, err := d.db.Exec(insertOCSPSQL,
+		rr.Serial,
+		rr.AKI,
+		rr.Body,
+		rr.Expiry.UTC(),
+	)
+	if err != nil {
+		return wrapCertStoreError(err)
+	}
+
+	numRowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return wrapCertStoreError(err)
+	}
+
+	if numRowsAffected != 1 {
+		return cferr.Wrap(cferr.CertStoreError, cferr.InsertionFailed,
+			errors.New("failed to insert the OCSP record"))
+	}
+
+	return nil
+}
+
+// GetOCSP gets a certdb.OCSPRecord indexed by serial and authority key
+// identifier.
+func (d *Accessor) GetOCSP(serial, aki string) ([]certdb.OCSPRecord, error) {
+	err := d.checkDB()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.queryOCSPs(selectOCSPBySerialAKISQL, serial, aki)
+}
+
+// GetUnexpiredOCSPs gets all OCSP responses from the db whose
+// nextUpdate has not yet passed.
+func (d *Accessor) GetUnexpiredOCSPs() ([]certdb.OCSPRecord, error) {
+	err := d.checkDB()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.queryOCSPs(selectUnexpiredOCSPSQL, time.Now().UTC())
+}
+
+// UpsertOCSP replaces the OCSP response stored for the certificate
+// identified by rr's serial and authority key identifier, inserting it
+// if there is none yet.
+func (d *Accessor) UpsertOCSP(rr certdb.OCSPRecord) error {
+	err := d.checkDB()
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return wrapCertStoreError(err)
+	}
+
+	var count int
+	err = tx.QueryRow(countOCSPBySerialAKISQL, rr.Serial, rr.AKI).Scan(&count)
+	if err == nil {
+		if count == 0 {
+			_, err = tx.Exec(insertOCSPSQL, rr.Serial, rr.AKI, rr.Body, rr.Expiry.UTC())
+		} else {
+			_, err = tx.Exec(updateOCSPSQL, rr.Body, rr.Expiry.UTC(), rr.Serial, rr.AKI)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return wrapCertStoreError(err)
+	}
+
+	return wrapCertStoreError(tx.Commit())
+}
+
+func (d *Accessor) queryOCSPs(query string, args ...interface{}) ([]certdb.OCSPRecord, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, wrapCertStoreError(err)
+	}
+	defer rows.Close()
+
+	var rrs []certdb.OCSPRecord
+	for rows.Next() {
+		var rr certdb.OCSPRecord
+		var expiry time.Time
+		err = rows.Scan(
+			&rr.Serial,
+			&rr.AKI,
+			&rr.Body,
+			&expiry,
+		)
+		if err != nil {
+			return nil, wrapCertStoreError(err)
+		}
+		rr.Expiry = expiry.UTC()
+		rrs = append(rrs, rr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, wrapCertStoreError(err)
+	}
+
+	return rrs, nil
+}
@@ -0,0 +1,223 @@
+package sql
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	cferr "github.com/cloudflare/cfssl/errors"
+)
+
+func TestInsertAndGetCertificate(t *testing.T) {
+	dba := NewAccessor(testdb.SQLiteDB())
+
+	expiry := time.Now().Add(time.Minute).UTC().Round(time.Second)
+	want := certdb.CertificateRecord{
+		Serial:    "1",
+		AKI:       "aki",
+		CALabel:   "default",
+		Profile:   "server",
+		Requester: "127.0.0.1:1234",
+		Status:    certdb.StatusGood,
+		Expiry:    expiry,
+		PEM:       "fake cert data",
+	}
+
+	if err := dba.InsertCertificate(want); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dba.InsertCertificate(want); err == nil {
+		t.Fatal("duplicate serial and AKI should be rejected")
+	}
+
+	crs, err := dba.GetCertificate(want.Serial, want.AKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crs) != 1 {
+		t.Fatalf("expected 1 certificate record, got %d", len(crs))
+	}
+
+	got := crs[0]
+	if !got.Expiry.Equal(want.Expiry) {
+		t.Fatalf("expiry mismatch: want %v, got %v", want.Expiry, got.Expiry)
+	}
+	got.Expiry = want.Expiry
+	got.RevokedAt = want.RevokedAt
+	if got != want {
+		t.Fatalf("record mismatch: want %+v, got %+v", want, got)
+	}
+
+	crs, err = dba.GetCertificate(want.Serial, "other aki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crs) != 0 {
+		t.Fatal("lookup should be keyed on both serial and AKI")
+	}
+}
+
+func TestGetUnexpiredCertificates(t *testing.T) {
+	dba := NewAccessor(testdb.SQLiteDB())
+
+	expired := certdb.CertificateRecord{
+		Serial: "1",
+		AKI:    "aki",
+		Status: certdb.StatusGood,
+		Expiry: time.Now().Add(-time.Hour),
+		PEM:    "expired cert",
+	}
+	valid := certdb.CertificateRecord{
+		Serial: "2",
+		AKI:    "aki",
+		Status: certdb.StatusGood,
+		Expiry: time.Now().Add(time.Hour),
+		PEM:    "valid cert",
+	}
+
+	for _, cr := range []certdb.CertificateRecord{expired, valid} {
+		if err := dba.InsertCertificate(cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	crs, err := dba.GetUnexpiredCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crs) != 1 || crs[0].Serial != valid.Serial {
+		t.Fatalf("expected only the unexpired certificate, got %+v", crs)
+	}
+}
+
+func TestRevokeCertificate(t *testing.T) {
+	dba := NewAccessor(testdb.SQLiteDB())
+
+	cr := certdb.CertificateRecord{
+		Serial: "1",
+		AKI:    "aki",
+		Status: certdb.StatusGood,
+		Expiry: time.Now().Add(time.Hour),
+		PEM:    "cert",
+	}
+	if err := dba.InsertCertificate(cr); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dba.RevokeCertificate(cr.Serial, cr.AKI, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	crs, err := dba.GetCertificate(cr.Serial, cr.AKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crs) != 1 {
+		t.Fatalf("expected 1 certificate record, got %d", len(crs))
+	}
+	if crs[0].Status != certdb.StatusRevoked || crs[0].Reason != 1 || crs[0].RevokedAt.IsZero() {
+		t.Fatalf("certificate not marked revoked: %+v", crs[0])
+	}
+
+	// A second revocation fails and leaves the first in place.
+	err = dba.RevokeCertificate(cr.Serial, cr.AKI, 4)
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != 10300 {
+		t.Fatalf("expected an AlreadyRevoked error, got %v", err)
+	}
+	again, err := dba.GetCertificate(cr.Serial, cr.AKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[0].Reason != 1 || !again[0].RevokedAt.Equal(crs[0].RevokedAt) {
+		t.Fatalf("second revocation changed the record: %+v", again[0])
+	}
+
+	err = dba.RevokeCertificate("2", cr.AKI, 1)
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != 10200 {
+		t.Fatalf("expected a RecordNotFound error, got %v", err)
+	}
+}
+
+func TestInsertAndGetOCSP(t *testing.T) {
+	dba := NewAccessor(testdb.SQLiteDB())
+
+	want := certdb.OCSPRecord{
+		Serial: "1",
+		AKI:    "aki",
+		Body:   []byte{0x30, 0x03, 0x0A, 0x01, 0x00},
+		Expiry: time.Now().Add(time.Minute).UTC().Round(time.Second),
+	}
+
+	if err := dba.InsertOCSP(want); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dba.InsertOCSP(want); err == nil {
+		t.Fatal("duplicate serial and AKI should be rejected")
+	}
+
+	rrs, err := dba.GetOCSP(want.Serial, want.AKI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 1 {
+		t.Fatalf("expected 1 OCSP record, got %d", len(rrs))
+	}
+	if !bytes.Equal(rrs[0].Body, want.Body) || !rrs[0].Expiry.Equal(want.Expiry) {
+		t.Fatalf("record mismatch: want %+v, got %+v", want, rrs[0])
+	}
+
+	rrs, err = dba.GetOCSP(want.Serial, "other aki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 0 {
+		t.Fatal("lookup should be keyed on both serial and AKI")
+	}
+}
+
+func TestUpsertOCSP(t *testing.T) {
+	dba := NewAccessor(testdb.SQLiteDB())
+
+	rr := certdb.OCSPRecord{
+		Serial: "1",
+		AKI:    "aki",
+		Body:   []byte("first"),
+		Expiry: time.Now().Add(-time.Minute),
+	}
+	if err := dba.UpsertOCSP(rr); err != nil {
+		t.Fatal(err)
+	}
+
+	rrs, err := dba.GetUnexpiredOCSPs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 0 {
+		t.Fatalf("expected no unexpired OCSP records, got %d", len(rrs))
+	}
+
+	rr.Body = []byte("second")
+	rr.Expiry = time.Now().Add(time.Hour)
+	if err = dba.UpsertOCSP(rr); err != nil {
+		t.Fatal(err)
+	}
+
+	rrs, err = dba.GetUnexpiredOCSPs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 1 || string(rrs[0].Body) != "second" {
+		t.Fatalf("OCSP record was not replaced: %+v", rrs)
+	}
+}
+
+func TestNilDB(t *testing.T) {
+	dba := NewAccessor(nil)
+	if err := dba.InsertCertificate(certdb.CertificateRecord{}); err == nil {
+		t.Fatal("accessor without a database should fail")
+	}
+}
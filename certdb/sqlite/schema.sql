@@ -0,0 +1,27 @@
+-- Schema for a SQLite certificate store. Create a new database with
+--
+--     sqlite3 certs.db < certdb/sqlite/schema.sql
+--
+-- and point a database configuration file at it.
+
+CREATE TABLE certificates (
+  serial_number            text NOT NULL,
+  authority_key_identifier text NOT NULL,
+  ca_label                 text,
+  profile                  text,
+  requester                text,
+  status                   text NOT NULL,
+  reason                   int,
+  expiry                   timestamp,
+  revoked_at               timestamp,
+  pem                      text NOT NULL,
+  PRIMARY KEY(serial_number, authority_key_identifier)
+);
+
+CREATE TABLE ocsp_responses (
+  serial_number            text NOT NULL,
+  authority_key_identifier text NOT NULL,
+  body                     blob NOT NULL,
+  expiry                   timestamp,
+  PRIMARY KEY(serial_number, authority_key_identifier)
+);
@@ -0,0 +1,52 @@
+// Package testdb provides a throwaway certificate store for use in
+// tests of packages that record certificates.
+package testdb
+
+import (
+	"database/sql"
+
+	// Register the SQLite driver.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema mirrors certdb/sqlite/schema.sql.
+const sqliteSchema = `
+CREATE TABLE certificates (
+  serial_number            text NOT NULL,
+  authority_key_identifier text NOT NULL,
+  ca_label                 text,
+  profile                  text,
+  requester                text,
+  status                   text NOT NULL,
+  reason                   int,
+  expiry                   timestamp,
+  revoked_at               timestamp,
+  pem                      text NOT NULL,
+  PRIMARY KEY(serial_number, authority_key_identifier)
+);
+
+CREATE TABLE ocsp_responses (
+  serial_number            text NOT NULL,
+  authority_key_identifier text NOT NULL,
+  body                     blob NOT NULL,
+  expiry                   timestamp,
+  PRIMARY KEY(serial_number, authority_key_identifier)
+);`
+
+// SQLiteDB returns a new, empty in-memory SQLite certificate store.
+// It panics if the database can't be set up.
+func SQLiteDB() *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		panic(err)
+	}
+
+	// Every connection to ":memory:" opens a distinct database, so
+	// keep the pool to a single connection.
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		panic(err)
+	}
+	return db
+}
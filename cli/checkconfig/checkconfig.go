@@ -0,0 +1,58 @@
+package checkconfig
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/config"
+)
+
+var checkConfigUsageText = `cfssl checkconfig -- check a configuration file for problems
+
+Usage of checkconfig:
+        cfssl checkconfig CONFIG
+
+Every problem found in the configuration is printed on its own line,
+with the path of the field at fault, and the command fails if there
+are any. A CONFIG of "-" reads the configuration from standard input.
+
+Flags:
+`
+
+var checkConfigFlags = []string{}
+
+func checkConfigMain(args []string, c cli.Config) error {
+	path, args, err := cli.PopFirstArgument(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("only one argument is accepted; please refer to the usage by flag -h")
+	}
+	return checkConfig(os.Stdout, path)
+}
+
+// checkConfig writes the problems with the configuration at path to w
+// and returns an error if there are any.
+func checkConfig(w io.Writer, path string) error {
+	body, err := cli.ReadStdin(path)
+	if err != nil {
+		return err
+	}
+
+	errs := config.CheckConfig(body)
+	for _, e := range errs {
+		fmt.Fprintln(w, e)
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%s: %d problem(s) found", path, len(errs))
+	}
+	fmt.Fprintf(w, "%s: configuration ok\n", path)
+	return nil
+}
+
+// Command assembles the definition of Command 'checkconfig'
+var Command = &cli.Command{UsageText: checkConfigUsageText, Flags: checkConfigFlags, Main: checkConfigMain}
@@ -0,0 +1,49 @@
+package checkconfig
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	var out bytes.Buffer
+	if err := checkConfig(&out, "../../config/testdata/valid_config.json"); err != nil {
+		t.Fatalf("valid configuration rejected: %v\n%s", err, out.String())
+	}
+
+	f, err := ioutil.TempFile("", "checkconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"signing": {
+		"default": {"expiry": "1y"},
+		"profiles": {
+			"server": {
+				"usages": ["signing", "serverauth"],
+				"expiry": "8760h",
+				"auth_key": "missing",
+				"policies": [{"id": "1.-2.3"}],
+				"extensions": [{"id": "7", "value": "0500"}]
+			}
+		}
+	}}`)
+	f.Close()
+
+	out.Reset()
+	if err = checkConfig(&out, f.Name()); err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 ||
+		!strings.HasPrefix(lines[0], "signing.default.expiry: ") ||
+		!strings.HasPrefix(lines[1], "signing.profiles.server.usages[1]: ") ||
+		!strings.HasPrefix(lines[2], "signing.profiles.server.policies[0].id: ") ||
+		!strings.HasPrefix(lines[3], "signing.profiles.server.extensions[0].id: ") ||
+		!strings.HasPrefix(lines[4], "signing.profiles.server.auth_key: ") {
+		t.Fatalf("unexpected problems reported:\n%s", out.String())
+	}
+}
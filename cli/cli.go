@@ -18,6 +18,10 @@ The commands are defined in the cli subpackages and include
 	gencert  generates a key and a signed certificate
 	selfsign generates a self-signed certificate
 	ocspsign signs an OCSP response
+	gencrl   generates a CRL signed by the CA
+	revoke   revokes a certificate in the certificate store
+	ocsprefresh refreshes the OCSP responses in the certificate store
+	checkconfig checks a configuration file for problems
 
 Use "cfssl [command] -help" to find out more about a command.
 */
@@ -32,6 +36,7 @@ import (
 	"os"
 
 	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/crl"
 )
 
 // Command holds the implementation details of a cfssl command.
@@ -136,6 +141,7 @@ func Start(cmds map[string]*Command) {
 
 	if err := cmd.Main(args, c); err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
 
@@ -169,6 +175,19 @@ func PrintCert(key, csrBytes, cert []byte) {
 	fmt.Printf("%s\n", jsonOut)
 }
 
+// PrintCRL outputs a DER-encoded CRL to stdout in PEM form
+func PrintCRL(der []byte) {
+	pemCRL := crl.EncodePEM(der)
+
+	out := map[string]string{}
+	out["crl"] = string(pemCRL)
+	jsonOut, err := json.Marshal(out)
+	if err != nil {
+		return
+	}
+	fmt.Printf("%s\n", jsonOut)
+}
+
 // PrintOCSPResponse outputs an OCSP response to stdout
 func PrintOCSPResponse(resp []byte) {
 	pemResponse := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: resp})
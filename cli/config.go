@@ -2,6 +2,7 @@ package cli
 
 import (
 	"flag"
+	"time"
 
 	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/helpers"
@@ -40,7 +41,7 @@ type Config struct {
 	PKCS11Label       string
 	ResponderFile     string
 	Status            string
-	Reason            int
+	Reason            string
 	RevokedAt         string
 	Interval          int64
 	List              bool
@@ -48,11 +49,16 @@ type Config struct {
 	Scanner           string
 	Responses         string
 	Path              string
+	DBConfigFile      string
+	Serial            string
+	AKI               string
+	Threshold         time.Duration
+	Loop              time.Duration
 }
 
 // registerFlags defines all cfssl command flags and associates their values with variables.
 func registerFlags(c *Config, f *flag.FlagSet) {
-	f.StringVar(&c.Hostname, "hostname", "", "Hostname for the cert, could be a comma-separated hostname list")
+	f.StringVar(&c.Hostname, "hostname", "", "Hostname for the cert, could be a comma-separated list of DNS names, IPs, email addresses and URIs")
 	f.StringVar(&c.CertFile, "cert", "", "Client certificate that contains the public key")
 	f.StringVar(&c.CSRFile, "csr", "", "Certificate signature request file for new public key")
 	f.StringVar(&c.CAFile, "ca", "ca.pem", "CA used to sign the new certificate")
@@ -76,7 +82,7 @@ func registerFlags(c *Config, f *flag.FlagSet) {
 	f.StringVar(&c.AuthKey, "authkey", "", "key to authenticate requests to remote CFSSL server")
 	f.StringVar(&c.ResponderFile, "responder", "", "Certificate for OCSP responder")
 	f.StringVar(&c.Status, "status", "good", "Status of the certificate: good, revoked, unknown")
-	f.IntVar(&c.Reason, "reason", 0, "Reason code for revocation")
+	f.StringVar(&c.Reason, "reason", "0", "Reason code or RFC 5280 reason name for revocation")
 	f.StringVar(&c.RevokedAt, "revoked-at", "now", "Date of revocation (YYYY-MM-DD)")
 	f.Int64Var(&c.Interval, "interval", int64(4*helpers.OneDay), "Interval between OCSP updates, in seconds (default: 4 days)")
 	f.BoolVar(&c.List, "list", false, "list possible scanners")
@@ -84,6 +90,11 @@ func registerFlags(c *Config, f *flag.FlagSet) {
 	f.StringVar(&c.Scanner, "scanner", "", "scanner regular expression")
 	f.StringVar(&c.Responses, "responses", "", "file to load OCSP responses from")
 	f.StringVar(&c.Path, "path", "/", "Path on which the server will listen")
+	f.StringVar(&c.DBConfigFile, "db-config", "", "certificate db configuration file")
+	f.StringVar(&c.Serial, "serial", "", "certificate serial number, in decimal")
+	f.StringVar(&c.AKI, "aki", "", "certificate authority key identifier, in hex")
+	f.DurationVar(&c.Threshold, "threshold", helpers.OneDay, "refresh OCSP responses that expire within this duration")
+	f.DurationVar(&c.Loop, "loop", 0, "if non-zero, repeat at this interval instead of running once")
 
 	if pkcs11.Enabled {
 		f.StringVar(&c.Module, "pkcs11-module", "", "PKCS #11 module")
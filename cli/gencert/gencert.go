@@ -17,7 +17,7 @@ var gencertUsageText = `cfssl gencert -- generate a new key and signed certifica
 
 Usage of gencert:
         cfssl gencert -initca CSRJSON
-        cfssl gencert -ca cert -ca-key key [-config config] [-profile profile] [-hostname hostname] CSRJSON
+        cfssl gencert -ca cert -ca-key key [-config config] [-profile profile] [-hostname hostname] [-db-config db-config] CSRJSON
         cfssl gencert -remote remote_host [-config config] [-profile profile] [-label label] [-hostname hostname] CSRJSON
 
 Arguments:
@@ -26,7 +26,7 @@ Arguments:
 Flags:
 `
 
-var gencertFlags = []string{"initca", "remote", "ca", "ca-key", "config", "hostname", "profile", "label"}
+var gencertFlags = []string{"initca", "remote", "ca", "ca-key", "config", "hostname", "profile", "label", "db-config"}
 
 func gencertMain(args []string, c cli.Config) (err error) {
 
@@ -0,0 +1,77 @@
+package gencrl
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/cli/sign"
+	"github.com/cloudflare/cfssl/crl"
+	"github.com/cloudflare/cfssl/log"
+)
+
+var gencrlUsageText = `cfssl gencrl -- generate a new CRL signed by the CA
+
+Usage of gencrl:
+        cfssl gencrl -ca cert -ca-key key REVOKEDJSON
+
+Arguments:
+        REVOKEDJSON:  JSON file containing the CRL request, use '-' for reading JSON from stdin
+
+The request lists the revoked certificates by decimal serial number,
+along with an optional RFC 5280 reason code and revocation time, and
+may set the time until nextUpdate and the CRL number:
+
+        {
+            "revoked_certificates": [
+                {"serial": "1234", "reason": 1, "revoked_at": "2015-06-01T00:00:00Z"}
+            ],
+            "expiry": "168h",
+            "number": 2
+        }
+
+Flags:
+`
+
+var gencrlFlags = []string{"ca", "ca-key"}
+
+func gencrlMain(args []string, c cli.Config) (err error) {
+	reqFile, args, err := cli.PopFirstArgument(args)
+	if err != nil {
+		return
+	}
+
+	reqBytes, err := cli.ReadStdin(reqFile)
+	if err != nil {
+		return
+	}
+
+	var req crl.Request
+	err = json.Unmarshal(reqBytes, &req)
+	if err != nil {
+		return
+	}
+
+	s, err := sign.SignerFromConfig(c)
+	if err != nil {
+		log.Critical("Unable to create signer: ", err)
+		return
+	}
+
+	crlSigner, ok := s.(crl.Signer)
+	if !ok {
+		return errors.New("signer does not support CRL generation")
+	}
+
+	der, err := crlSigner.SignCRL(req)
+	if err != nil {
+		log.Critical("Unable to generate CRL: ", err)
+		return
+	}
+
+	cli.PrintCRL(der)
+	return
+}
+
+// Command assembles the definition of Command 'gencrl'
+var Command = &cli.Command{UsageText: gencrlUsageText, Flags: gencrlFlags, Main: gencrlMain}
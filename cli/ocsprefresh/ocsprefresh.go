@@ -0,0 +1,94 @@
+package ocsprefresh
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	certsql "github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/ocsp"
+)
+
+// Usage text of 'cfssl ocsprefresh'
+var ocsprefreshUsageText = `cfssl ocsprefresh -- refresh the OCSP responses in a certificate store
+
+Usage of ocsprefresh:
+        cfssl ocsprefresh -db-config db-config -ca cert -responder cert -key key \
+                          [-interval interval] [-threshold duration] [-loop duration]
+
+Signs new OCSP responses for every unexpired certificate issued by the CA
+whose stored response is missing, expires within the threshold (one day
+by default), or no longer reflects the certificate's status, and stores
+them in the certificate store. With -loop, the refresh is repeated at the
+given interval instead of running once.
+
+Flags:
+`
+
+// Flags of 'cfssl ocsprefresh'
+var ocsprefreshFlags = []string{"db-config", "ca", "responder", "key", "interval", "threshold", "loop"}
+
+// ocsprefreshMain is the main CLI of OCSP refresh functionality.
+func ocsprefreshMain(args []string, c cli.Config) (err error) {
+	if len(args) > 0 {
+		return errors.New("argument is provided but not defined; please refer to the usage by flag -h")
+	}
+
+	if c.DBConfigFile == "" {
+		return errors.New("need a certificate store configuration (provide with -db-config)")
+	}
+	if c.ResponderFile == "" || c.KeyFile == "" {
+		return errors.New("need a responder certificate and key (provide with -responder and -key)")
+	}
+
+	issuerBytes, err := ioutil.ReadFile(c.CAFile)
+	if err != nil {
+		log.Critical("Unable to read CA certificate: ", err)
+		return
+	}
+	issuer, err := helpers.ParseCertificatePEM(issuerBytes)
+	if err != nil {
+		log.Critical("Unable to parse CA certificate: ", err)
+		return
+	}
+
+	s, err := ocsp.NewSignerFromFile(c.CAFile, c.ResponderFile, c.KeyFile, time.Duration(c.Interval))
+	if err != nil {
+		log.Critical("Unable to create OCSP signer: ", err)
+		return
+	}
+
+	db, err := dbconf.DBFromConfig(c.DBConfigFile)
+	if err != nil {
+		log.Critical("Unable to open certificate store: ", err)
+		return
+	}
+	dbAccessor := certsql.NewAccessor(db)
+
+	// Certificates are recorded under the hex-encoded authority key
+	// identifier, which is the issuer's subject key identifier.
+	aki := hex.EncodeToString(issuer.SubjectKeyId)
+
+	for {
+		_, err = ocsp.Refresh(dbAccessor, s, aki, c.Threshold)
+		if c.Loop <= 0 {
+			if err != nil {
+				log.Critical("Unable to refresh OCSP responses: ", err)
+			}
+			return
+		}
+
+		if err != nil {
+			log.Errorf("Unable to refresh OCSP responses: %v", err)
+		}
+		time.Sleep(c.Loop)
+	}
+}
+
+// Command assembles the definition of Command 'ocsprefresh'
+var Command = &cli.Command{UsageText: ocsprefreshUsageText, Flags: ocsprefreshFlags, Main: ocsprefreshMain}
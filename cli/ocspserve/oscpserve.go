@@ -4,23 +4,32 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	certsql "github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/ocsp"
 )
 
 // Usage text of 'cfssl serve'
-var ocspServerUsageText = `cfssl ocspserve -- set up an HTTP server that handles OCSP requests from a file (see RFC 5019)
+var ocspServerUsageText = `cfssl ocspserve -- set up an HTTP server that handles OCSP requests from a file or a certificate store (see RFC 5019)
 
   Usage of ocspserve:
           cfssl ocspserve [-address address] [-port port] [-responses file]
+          cfssl ocspserve [-address address] [-port port] [-db-config db-config]
+          cfssl ocspserve [-address address] [-port port] [-db-config db-config] \
+                          -ca cert -responder cert -key key [-interval interval]
+
+  With a responder certificate and key, a fresh response is signed for every
+  request, echoing the request's nonce, instead of serving pre-signed responses.
 
   Flags:
   `
 
 // Flags used by 'cfssl serve'
-var ocspServerFlags = []string{"address", "port", "responses"}
+var ocspServerFlags = []string{"address", "port", "responses", "db-config", "ca", "responder", "key", "interval"}
 
 // ocspServerMain is the command line entry point to the OCSP responder.
 // It sets up a new HTTP server that responds to OCSP requests.
@@ -30,13 +39,34 @@ func ocspServerMain(args []string, c cli.Config) error {
 		return errors.New("argument is provided but not defined; please refer to the usage by flag -h")
 	}
 
-	if c.Responses == "" {
-		return errors.New("no response file provided, please set the -responses flag")
-	}
+	var src ocsp.Source
+	switch {
+	case c.DBConfigFile != "":
+		db, err := dbconf.DBFromConfig(c.DBConfigFile)
+		if err != nil {
+			return errors.New("unable to open certificate store")
+		}
+		dbAccessor := certsql.NewAccessor(db)
+
+		if c.ResponderFile == "" || c.KeyFile == "" {
+			src = ocsp.NewDBSource(dbAccessor)
+			break
+		}
 
-	src, err := ocsp.NewSourceFromFile(c.Responses)
-	if err != nil {
-		return errors.New("unable to read response file")
+		signer, err := ocsp.NewSignerFromFile(c.CAFile, c.ResponderFile, c.KeyFile, time.Duration(c.Interval))
+		if err != nil {
+			return errors.New("unable to create OCSP signer")
+		}
+		log.Info("Signing OCSP responses for every request")
+		src = ocsp.NewSignerSource(signer, dbAccessor)
+	case c.Responses != "":
+		var err error
+		src, err = ocsp.NewSourceFromFile(c.Responses)
+		if err != nil {
+			return errors.New("unable to read response file")
+		}
+	default:
+		return errors.New("no response source provided, please set the -responses or -db-config flag")
 	}
 
 	log.Info("Registering OCSP responder handler")
@@ -42,7 +42,11 @@ func ocspSignerMain(args []string, c cli.Config) (err error) {
 	}
 
 	if c.Status == "revoked" {
-		req.Reason = c.Reason
+		req.Reason, err = ocsp.ReasonStringToCode(c.Reason)
+		if err != nil {
+			log.Critical("Invalid reason code: ", err)
+			return
+		}
 
 		req.RevokedAt = time.Now()
 		if c.RevokedAt != "now" {
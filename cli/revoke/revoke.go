@@ -0,0 +1,129 @@
+package revoke
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	certsql "github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/cli"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/ocsp"
+)
+
+var revokeUsageText = `cfssl revoke -- revoke a certificate in the certificate store
+
+Usage of revoke:
+        cfssl revoke -db-config config -serial serial -aki authority_key_id \
+                     [-reason reason] [-ca cert -responder cert -key key]
+
+The certificate is identified by its serial number, in decimal, and the
+hex-encoded authority key identifier of its issuer, as recorded in the
+certificate store. The reason may be an RFC 5280 reason code or name,
+such as "keyCompromise"; it defaults to unspecified.
+
+If a responder certificate and key are given, a new OCSP response
+reflecting the revocation is signed, stored in the certificate store
+and printed. Revoking a certificate again leaves its revocation as it
+was, but signs and stores a new OCSP response for it.
+
+Flags:
+`
+
+var revokeFlags = []string{"db-config", "serial", "aki", "reason", "ca", "responder", "key", "interval"}
+
+func revokeMain(args []string, c cli.Config) (err error) {
+	if len(args) > 0 {
+		return errors.New("argument is provided but not defined; please refer to the usage by flag -h")
+	}
+
+	if c.DBConfigFile == "" {
+		return errors.New("need a certificate store configuration (provide with -db-config)")
+	}
+	if c.Serial == "" {
+		return errors.New("need a certificate serial number (provide with -serial)")
+	}
+	if c.AKI == "" {
+		return errors.New("need a certificate authority key identifier (provide with -aki)")
+	}
+
+	reasonCode, err := ocsp.ReasonStringToCode(c.Reason)
+	if err != nil {
+		log.Critical("Invalid reason code: ", err)
+		return
+	}
+
+	db, err := dbconf.DBFromConfig(c.DBConfigFile)
+	if err != nil {
+		log.Critical("Unable to open certificate store: ", err)
+		return
+	}
+	dbAccessor := certsql.NewAccessor(db)
+
+	err = dbAccessor.RevokeCertificate(c.Serial, c.AKI, reasonCode)
+	if cfErr, ok := err.(*cferr.Error); ok && cfErr.ErrorCode == int(cferr.CertStoreError)+int(cferr.AlreadyRevoked) {
+		// The first revocation stands; only its OCSP response, which
+		// may be missing if an earlier run failed to sign it, is
+		// signed again.
+		if c.ResponderFile == "" || c.KeyFile == "" {
+			return fmt.Errorf("certificate %s is already revoked; its revocation is left unchanged", c.Serial)
+		}
+		log.Warningf("certificate %s is already revoked; signing its OCSP response again", c.Serial)
+	} else if err != nil {
+		log.Critical("Unable to revoke certificate: ", err)
+		return
+	} else {
+		log.Infof("revoked certificate %s", c.Serial)
+	}
+
+	if c.ResponderFile == "" || c.KeyFile == "" {
+		return
+	}
+
+	crs, err := dbAccessor.GetCertificate(c.Serial, c.AKI)
+	if err != nil {
+		log.Critical("Unable to read certificate record: ", err)
+		return
+	}
+	if len(crs) != 1 {
+		return errors.New("certificate record not found after revocation")
+	}
+
+	req, err := ocsp.NewSignRequestFromRecord(crs[0])
+	if err != nil {
+		log.Critical("Unable to parse certificate record: ", err)
+		return
+	}
+
+	s, err := ocsp.NewSignerFromFile(c.CAFile, c.ResponderFile, c.KeyFile, time.Duration(c.Interval))
+	if err != nil {
+		log.Critical("Unable to create OCSP signer: ", err)
+		return
+	}
+
+	resp, err := s.Sign(req)
+	if err != nil {
+		log.Critical("Unable to sign OCSP response: ", err)
+		return
+	}
+
+	rr, err := ocsp.NewOCSPRecord(c.AKI, resp)
+	if err != nil {
+		log.Critical("Unable to parse OCSP response: ", err)
+		return
+	}
+
+	err = dbAccessor.UpsertOCSP(rr)
+	if err != nil {
+		log.Critical("Unable to store OCSP response: ", err)
+		return
+	}
+
+	cli.PrintOCSPResponse(resp)
+	return
+}
+
+// Command assembles the definition of Command 'revoke'
+var Command = &cli.Command{UsageText: revokeUsageText, Flags: revokeFlags, Main: revokeMain}
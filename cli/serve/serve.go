@@ -1,20 +1,28 @@
 package serve
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/cloudflare/cfssl/api/bundle"
+	"github.com/cloudflare/cfssl/api/crl"
 	"github.com/cloudflare/cfssl/api/generator"
 	"github.com/cloudflare/cfssl/api/info"
 	"github.com/cloudflare/cfssl/api/initca"
+	"github.com/cloudflare/cfssl/api/revoke"
 	"github.com/cloudflare/cfssl/api/scan"
 	apisign "github.com/cloudflare/cfssl/api/sign"
+	"github.com/cloudflare/cfssl/auth"
 	"github.com/cloudflare/cfssl/bundler"
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	certsql "github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/cli/sign"
 	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/ocsp"
 	"github.com/cloudflare/cfssl/ubiquity"
 )
 
@@ -24,18 +32,29 @@ var serverUsageText = `cfssl serve -- set up a HTTP server handles CF SSL reques
 Usage of serve:
         cfssl serve [-address address] [-ca cert] [-ca-bundle bundle] \
                     [-ca-key key] [-int-bundle bundle] [-port port] [-metadata file] \
-                    [-remote remote_host] [-config config]
+                    [-remote remote_host] [-config config] [-db-config db-config] \
+                    [-responder cert] [-key key]
 
 Flags:
 `
 
 // Flags used by 'cfssl serve'
-var serverFlags = []string{"address", "port", "ca", "ca-key", "ca-bundle", "int-bundle", "int-dir", "metadata", "remote", "config"}
+var serverFlags = []string{"address", "port", "ca", "ca-key", "ca-bundle", "int-bundle", "int-dir", "metadata", "remote", "config", "db-config", "responder", "key", "interval"}
 
 // registerHandlers instantiates various handlers and associate them to corresponding endpoints.
 func registerHandlers(c cli.Config) error {
+	var db *sql.DB
+	if c.DBConfigFile != "" {
+		var err error
+		db, err = dbconf.DBFromConfig(c.DBConfigFile)
+		if err != nil {
+			log.Errorf("Failed to open certificate store: %v", err)
+			return err
+		}
+	}
+
 	log.Info("Setting up signer endpoint")
-	s, err := sign.SignerFromConfig(c)
+	s, err := sign.SignerFromConfigAndDB(c, db)
 	if err != nil {
 		log.Warningf("sign and authsign endpoints are disabled: %v", err)
 	} else {
@@ -52,6 +71,20 @@ func registerHandlers(c cli.Config) error {
 		} else {
 			log.Warningf("endpoint '/api/v1/cfssl/authsign' is disabled: %v", err)
 		}
+
+		if crlHandler, err := crl.NewHandlerFromSigner(s); err == nil {
+			log.Info("Assigning handler to /crl")
+			http.Handle("/api/v1/cfssl/crl", crlHandler)
+		} else {
+			log.Warningf("endpoint '/api/v1/cfssl/crl' is disabled: %v", err)
+		}
+	}
+
+	log.Info("Setting up revoke endpoint")
+	if revokeHandler, err := newRevokeHandler(c, db); err == nil {
+		http.Handle("/api/v1/cfssl/revoke", revokeHandler)
+	} else {
+		log.Warningf("endpoint '/api/v1/cfssl/revoke' is disabled: %v", err)
 	}
 
 	log.Info("Setting up info endpoint")
@@ -99,6 +132,34 @@ func registerHandlers(c cli.Config) error {
 	return nil
 }
 
+// newRevokeHandler sets up the revocation handler. Revocation requires
+// a certificate store and a responder certificate and key, with which
+// a fresh OCSP response is signed for each revoked certificate, and is
+// authenticated with the default signing profile's auth key.
+func newRevokeHandler(c cli.Config, db *sql.DB) (http.Handler, error) {
+	if db == nil {
+		return nil, errors.New("no certificate store configured")
+	}
+
+	var provider auth.Provider
+	if c.CFG != nil && c.CFG.Signing != nil && c.CFG.Signing.Default != nil {
+		provider = c.CFG.Signing.Default.Provider
+	}
+	if provider == nil {
+		return nil, errors.New("the default signing profile has no auth key")
+	}
+
+	if c.ResponderFile == "" || c.KeyFile == "" {
+		return nil, errors.New("no OCSP responder certificate and key given")
+	}
+	ocspSigner, err := ocsp.NewSignerFromFile(c.CAFile, c.ResponderFile, c.KeyFile, time.Duration(c.Interval))
+	if err != nil {
+		return nil, err
+	}
+
+	return revoke.NewHandler(certsql.NewAccessor(db), ocspSigner, provider)
+}
+
 // serverMain is the command line entry point to the API server. It sets up a
 // new HTTP server to handle sign, bundle, and validate requests.
 func serverMain(args []string, c cli.Config) error {
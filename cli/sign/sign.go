@@ -1,9 +1,12 @@
 package sign
 
 import (
+	"database/sql"
 	"encoding/json"
 	"io/ioutil"
 
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	certsql "github.com/cloudflare/cfssl/certdb/sql"
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/log"
@@ -15,7 +18,7 @@ import (
 var signerUsageText = `cfssl sign -- signs a client cert with a host name by a given CA and CA key
 
 Usage of sign:
-        cfssl sign -ca cert -ca-key key [-config config] [-profile profile] [-hostname hostname] CSR [SUBJECT]
+        cfssl sign -ca cert -ca-key key [-config config] [-profile profile] [-hostname hostname] [-db-config db-config] CSR [SUBJECT]
         cfssl sign -remote remote_host [-config config] [-profile profile] [-label label] [-hostname hostname] CSR [SUBJECT]
 
 Arguments:
@@ -29,11 +32,29 @@ Flags:
 `
 
 // Flags of 'cfssl sign'
-var signerFlags = []string{"hostname", "csr", "ca", "ca-key", "config", "profile", "label", "remote"}
+var signerFlags = []string{"hostname", "csr", "ca", "ca-key", "config", "profile", "label", "remote", "db-config"}
 
 // SignerFromConfig takes the Config and creates the appropriate
 // signer.Signer object
 func SignerFromConfig(c cli.Config) (signer.Signer, error) {
+	// If a certificate store is configured, record every
+	// certificate issued by this signer in it.
+	var db *sql.DB
+	if c.DBConfigFile != "" {
+		var err error
+		db, err = dbconf.DBFromConfig(c.DBConfigFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return SignerFromConfigAndDB(c, db)
+}
+
+// SignerFromConfigAndDB takes the Config and a certificate store
+// handle, which may be nil, and creates the appropriate signer.Signer
+// object.
+func SignerFromConfigAndDB(c cli.Config, db *sql.DB) (signer.Signer, error) {
 	// If there is a config, use its signing policy. Otherwise create a default policy.
 	var policy *config.Signing
 	if c.CFG != nil {
@@ -59,6 +80,10 @@ func SignerFromConfig(c cli.Config) (signer.Signer, error) {
 		return nil, err
 	}
 
+	if db != nil {
+		s.SetDBAccessor(certsql.NewAccessor(db))
+	}
+
 	return s, nil
 }
 
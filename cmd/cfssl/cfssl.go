@@ -15,6 +15,10 @@ Usage:
 	genkey   generates a key and an associated CSR
 	gencert  generates a key and a signed certificate
 	selfsign generates a self-signed certificate
+	gencrl   generates a CRL signed by the CA
+	revoke   revokes a certificate in the certificate store
+	ocsprefresh refreshes the OCSP responses in the certificate store
+	checkconfig checks a configuration file for problems
 
 Use "cfssl [command] -help" to find out more about a command.
 */
@@ -25,16 +29,23 @@ import (
 
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/cli/bundle"
+	"github.com/cloudflare/cfssl/cli/checkconfig"
 	"github.com/cloudflare/cfssl/cli/gencert"
+	"github.com/cloudflare/cfssl/cli/gencrl"
 	"github.com/cloudflare/cfssl/cli/genkey"
+	"github.com/cloudflare/cfssl/cli/ocsprefresh"
 	"github.com/cloudflare/cfssl/cli/ocspserve"
 	"github.com/cloudflare/cfssl/cli/ocspsign"
+	"github.com/cloudflare/cfssl/cli/revoke"
 	"github.com/cloudflare/cfssl/cli/scan"
 	"github.com/cloudflare/cfssl/cli/selfsign"
 	"github.com/cloudflare/cfssl/cli/serve"
 	"github.com/cloudflare/cfssl/cli/sign"
 	"github.com/cloudflare/cfssl/cli/version"
 	"github.com/cloudflare/cfssl/log"
+
+	// Register the SQLite driver for certificate stores.
+	_ "github.com/mattn/go-sqlite3"
 )
 
 // main defines the cfssl usage and registers all defined commands and flags.
@@ -44,16 +55,20 @@ func main() {
 	flag.IntVar(&log.Level, "loglevel", log.LevelInfo, "Log level")
 	// Register commands.
 	cmds := map[string]*cli.Command{
-		"bundle":    bundle.Command,
-		"sign":      sign.Command,
-		"serve":     serve.Command,
-		"version":   version.Command,
-		"genkey":    genkey.Command,
-		"gencert":   gencert.Command,
-		"ocspsign":  ocspsign.Command,
-		"ocspserve": ocspserve.Command,
-		"selfsign":  selfsign.Command,
-		"scan":      scan.Command,
+		"bundle":      bundle.Command,
+		"sign":        sign.Command,
+		"serve":       serve.Command,
+		"version":     version.Command,
+		"genkey":      genkey.Command,
+		"gencert":     gencert.Command,
+		"gencrl":      gencrl.Command,
+		"ocspsign":    ocspsign.Command,
+		"ocspserve":   ocspserve.Command,
+		"ocsprefresh": ocsprefresh.Command,
+		"revoke":      revoke.Command,
+		"selfsign":    selfsign.Command,
+		"scan":        scan.Command,
+		"checkconfig": checkconfig.Command,
 	}
 	// Register all command flags.
 	cli.Start(cmds)
@@ -105,4 +105,8 @@ func main() {
 	if contents, ok := input["bundle"]; ok {
 		writeFile(baseName+"-bundle.pem", contents.(string), 0644)
 	}
+
+	if contents, ok := input["crl"]; ok {
+		writeFile(baseName+".crl", contents.(string), 0644)
+	}
 }
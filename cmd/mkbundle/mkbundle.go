@@ -1,11 +1,14 @@
 // mkbundle is a commandline tool for building certificate pool bundles.
 // All certificates in the input file paths are checked for revocation and bundled together.
+// Each certificate is checked along with the chain of its issuers found in the same file,
+// so that OCSP can be used without fetching the issuer.
 //
 // Usage:
-//	mkbundle -f bundle_file -nw number_of_workers certificate_file_path ...
+//	mkbundle -f bundle_file -nw number_of_workers [-crl-dir dir] certificate_file_path ...
 package main
 
 import (
+	"bytes"
 	"crypto/x509"
 	"encoding/pem"
 	"flag"
@@ -18,10 +21,36 @@ import (
 	"github.com/cloudflare/cfssl/revoke"
 )
 
+// issuerChain returns the chain of cert and its issuers, ordered from
+// cert towards the root, as far as the issuers are found in certs.
+func issuerChain(cert *x509.Certificate, certs []*x509.Certificate) []*x509.Certificate {
+	chain := []*x509.Certificate{cert}
+	for len(chain) <= len(certs) {
+		last := chain[len(chain)-1]
+		if bytes.Equal(last.RawIssuer, last.RawSubject) {
+			break
+		}
+
+		var issuer *x509.Certificate
+		for _, c := range certs {
+			if bytes.Equal(last.RawIssuer, c.RawSubject) && last.CheckSignatureFrom(c) == nil {
+				issuer = c
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+	}
+	return chain
+}
+
 // worker does all the parsing and validation of the certificate(s)
 // contained in a single file. It first reads all the data in the
 // file, then begins parsing certificates in the file. Those
-// certificates are then checked for revocation.
+// certificates are then checked for revocation, each with its
+// issuers from the file.
 func worker(paths chan string, bundler chan *x509.Certificate, pool *sync.WaitGroup) {
 	defer (*pool).Done()
 	for {
@@ -38,6 +67,7 @@ func worker(paths chan string, bundler chan *x509.Certificate, pool *sync.WaitGr
 			continue
 		}
 
+		var certs []*x509.Certificate
 		for {
 			var block *pem.Block
 			if len(fileData) == 0 {
@@ -58,14 +88,18 @@ func worker(paths chan string, bundler chan *x509.Certificate, pool *sync.WaitGr
 				continue
 			}
 
+			certs = append(certs, cert)
+		}
+
+		for _, cert := range certs {
 			log.Infof("Validating %+v", cert.Subject)
-			revoked, ok := revoke.VerifyCertificate(cert)
-			if !ok {
-				log.Warning("Failed to verify certificate.")
-			} else if !revoked {
+			result := revoke.CheckChain(issuerChain(cert, certs))
+			if !result.OK {
+				log.Warningf("Failed to verify certificate: %s", result)
+			} else if !result.Revoked {
 				bundler <- cert
 			} else {
-				log.Info("Skipping revoked certificate")
+				log.Infof("Skipping revoked certificate: %s", result)
 			}
 		}
 	}
@@ -141,9 +175,11 @@ func main() {
 	logLevel := flag.Int("loglevel", log.LevelWarning, "verbosity of logs (0-5, 0 is very noisy)")
 	bundleFile := flag.String("f", "cert-bundle.crt", "path to store certificate bundle")
 	numWorkers := flag.Int("nw", 4, "number of workers")
+	crlDir := flag.String("crl-dir", "", "directory in which to cache fetched CRLs")
 	flag.Parse()
 
 	log.Level = *logLevel
+	revoke.CRLSet.Dir = *crlDir
 
 	paths := make(chan string)
 	bundler := make(chan *x509.Certificate)
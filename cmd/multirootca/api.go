@@ -125,6 +125,7 @@ func dispatchRequest(w http.ResponseWriter, req *http.Request) {
 	if sigRequest.Label == "" {
 		sigRequest.Label = defaultLabel
 	}
+	sigRequest.Requester = req.RemoteAddr
 
 	s, ok := signers[sigRequest.Label]
 	if !ok {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"errors"
 	"flag"
@@ -17,15 +18,16 @@ import (
 	"github.com/kisom/whitelist"
 )
 
-func parseSigner(root *config.Root) (signer.Signer, error) {
+func parseSigner(label string, root *config.Root) (signer.Signer, error) {
 	privateKey := root.PrivateKey
 	switch priv := privateKey.(type) {
-	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
 		s, err := local.NewSigner(priv, root.Certificate, signer.DefaultSigAlgo(priv), nil)
 		if err != nil {
 			return nil, err
 		}
 		s.SetPolicy(root.Config)
+		s.SetLabel(label)
 		return s, nil
 	default:
 		return nil, errors.New("unsupported private key type")
@@ -56,7 +58,7 @@ func main() {
 	}
 
 	for label, root := range roots {
-		s, err := parseSigner(root)
+		s, err := parseSigner(label, root)
 		if err != nil {
 			log.Criticalf("%v", err)
 		}
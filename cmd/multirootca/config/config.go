@@ -99,43 +99,60 @@ type Root struct {
 // ErrUnsupportedScheme indicates a private key scheme that is not currently supported.
 var ErrUnsupportedScheme = errors.New("config: unsupported private key scheme")
 
+// parsePrivateKeySpec loads the private key named by spec: file://path
+// (or file:/path) for a key file, or env:NAME for a key held in the
+// environment variable NAME, as described for config.ResolveSecret.
 func parsePrivateKeySpec(spec string) (crypto.Signer, error) {
 	specURL, err := url.Parse(spec)
 	if err != nil {
 		return nil, err
 	}
 
-	var priv crypto.Signer
 	switch specURL.Scheme {
 	case "file":
 		// A file spec will be parsed such that the root
 		// directory of a relative path will be stored as the
 		// hostname, and the remainder of the file's path is
-		// stored in the Path field.
-		log.Debug("loading private key file", specURL.Path)
+		// stored in the Path field. A file: spec without the
+		// slashes stores the whole path as opaque data.
 		path := filepath.Join(specURL.Host, specURL.Path)
+		if specURL.Opaque != "" {
+			path = specURL.Opaque
+		}
+		log.Debug("loading private key file ", path)
 		in, err := ioutil.ReadFile(path)
 		if err != nil {
 			return nil, err
 		}
-
-		log.Debug("attempting to load PEM-encoded private key")
-		priv, err = helpers.ParsePrivateKeyPEM(in)
+		return parsePrivateKey(in)
+	case "env":
+		log.Debug("loading private key from environment variable ", specURL.Opaque)
+		in, err := config.ResolveSecret(spec)
 		if err != nil {
-			log.Debug("file is not a PEM-encoded private key")
-			log.Debug("attempting to load DER-encoded private key")
-			priv, err = helpers.ParsePrivateKeyDER(in)
-			if err != nil {
-				return nil, err
-			}
+			return nil, err
 		}
-		log.Debug("loaded private key")
-		return priv, nil
+		return parsePrivateKey([]byte(in))
 	default:
 		return nil, ErrUnsupportedScheme
 	}
 }
 
+// parsePrivateKey parses a PEM- or DER-encoded private key.
+func parsePrivateKey(in []byte) (crypto.Signer, error) {
+	log.Debug("attempting to load PEM-encoded private key")
+	priv, err := helpers.ParsePrivateKeyPEM(in)
+	if err != nil {
+		log.Debug("file is not a PEM-encoded private key")
+		log.Debug("attempting to load DER-encoded private key")
+		priv, err = helpers.ParsePrivateKeyDER(in)
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Debug("loaded private key")
+	return priv, nil
+}
+
 // A RootList associates a set of labels with the appropriate private
 // keys and their certificates.
 type RootList map[string]*Root
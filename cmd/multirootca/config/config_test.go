@@ -2,6 +2,7 @@ package config
 
 import (
 	"crypto/rsa"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -127,6 +128,32 @@ func TestLoadDERRoots(t *testing.T) {
 	}
 }
 
+func TestLoadEnvRoots(t *testing.T) {
+	if _, err := Parse("testdata/roots_env.conf"); err == nil {
+		t.Fatal("expected an error with the key's environment variable unset")
+	}
+
+	key, err := ioutil.ReadFile("testdata/server.key")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	os.Setenv("CFSSL_TEST_ROOT_KEY", string(key))
+	defer os.Unsetenv("CFSSL_TEST_ROOT_KEY")
+
+	roots, err := Parse("testdata/roots_env.conf")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, label := range []string{"primary", "backup"} {
+		if root, ok := roots[label]; !ok {
+			t.Fatalf("expected a %s CA section", label)
+		} else if _, ok := root.PrivateKey.(*rsa.PrivateKey); !ok {
+			t.Fatal("expected an RSA private key")
+		}
+	}
+}
+
 func TestLoadKSMRoot(t *testing.T) {
 	_, err := Parse("testdata/roots_ksm.conf")
 	if err == nil {
@@ -2,12 +2,24 @@
 package config
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -30,6 +42,201 @@ import (
 type CSRWhitelist struct {
 	Subject, PublicKeyAlgorithm, PublicKey, SignatureAlgorithm bool
 	DNSNames, IPAddresses bool
+	EmailAddresses, URIs bool
+}
+
+// NameConstraints restricts the names that a CA certificate may issue
+// certificates for. DNS domains are given as "example.com", which
+// also covers its subdomains; IP ranges in CIDR notation; and email
+// constraints as a mailbox ("user@example.com"), a host
+// ("example.com") or a domain whose subdomains are covered
+// (".example.com").
+type NameConstraints struct {
+	PermittedDNSDomains     []string `json:"permitted_dns_domains"`
+	ExcludedDNSDomains      []string `json:"excluded_dns_domains"`
+	PermittedIPRanges       []string `json:"permitted_ip_ranges"`
+	ExcludedIPRanges        []string `json:"excluded_ip_ranges"`
+	PermittedEmailAddresses []string `json:"permitted_email_addresses"`
+	ExcludedEmailAddresses  []string `json:"excluded_email_addresses"`
+
+	PermittedIPNets []*net.IPNet `json:"-"`
+	ExcludedIPNets  []*net.IPNet `json:"-"`
+}
+
+// AllowedNames restricts the names that may appear in certificates
+// signed under a profile, whether they come from the CSR or from the
+// request's hosts. A DNS name is allowed if it is covered by one of
+// the DNS suffixes ("example.com" covers example.com and its
+// subdomains, ".example.com" only its subdomains) or fully matches one
+// of the DNS patterns, which are regular expressions. An IP address
+// is allowed if it lies in one of the IP ranges, given in CIDR
+// notation.
+type AllowedNames struct {
+	DNSSuffixes []string `json:"dns_suffixes"`
+	DNSPatterns []string `json:"dns_patterns"`
+	IPRanges    []string `json:"ip_ranges"`
+
+	DNSRegexps []*regexp.Regexp `json:"-"`
+	IPNets     []*net.IPNet     `json:"-"`
+}
+
+// populate validates the allowed names and compiles their patterns and
+// IP ranges.
+func (an *AllowedNames) populate() error {
+	for _, suffix := range an.DNSSuffixes {
+		if !validConstraintDomain(suffix, true) {
+			return errors.New("invalid allowed DNS suffix: " + suffix)
+		}
+	}
+
+	an.DNSRegexps = nil
+	for _, pattern := range an.DNSPatterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return err
+		}
+		an.DNSRegexps = append(an.DNSRegexps, re)
+	}
+
+	var err error
+	an.IPNets, err = parseIPRanges(an.IPRanges)
+	return err
+}
+
+// PermitsDNSName reports whether a DNS name is allowed.
+func (an *AllowedNames) PermitsDNSName(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, suffix := range an.DNSSuffixes {
+		suffix = strings.ToLower(suffix)
+		if strings.HasPrefix(suffix, ".") {
+			if strings.HasSuffix(name, suffix) {
+				return true
+			}
+		} else if name == suffix || strings.HasSuffix(name, "."+suffix) {
+			return true
+		}
+	}
+
+	for _, re := range an.DNSRegexps {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermitsIP reports whether an IP address is allowed.
+func (an *AllowedNames) PermitsIP(ip net.IP) bool {
+	for _, ipNet := range an.IPNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// A CertificatePolicy names a certificate policy by its OID and may
+// carry policy qualifiers. In JSON, a policy without qualifiers can
+// also be given as a bare OID string.
+type CertificatePolicy struct {
+	ID         string                       `json:"id"`
+	Qualifiers []CertificatePolicyQualifier `json:"qualifiers,omitempty"`
+}
+
+// UnmarshalJSON accepts either a policy object or a bare OID string.
+func (cp *CertificatePolicy) UnmarshalJSON(data []byte) error {
+	var id string
+	if err := json.Unmarshal(data, &id); err == nil {
+		*cp = CertificatePolicy{ID: id}
+		return nil
+	}
+
+	type policy CertificatePolicy
+	return json.Unmarshal(data, (*policy)(cp))
+}
+
+// The types of certificate policy qualifier.
+const (
+	// CPSQualifierType is a qualifier whose value is the URI of a
+	// certification practice statement.
+	CPSQualifierType = "id-qt-cps"
+	// UserNoticeQualifierType is a qualifier whose value is the
+	// explicit text of a user notice.
+	UserNoticeQualifierType = "id-qt-unotice"
+)
+
+// A CertificatePolicyQualifier is a policy qualifier: either a CPS URI
+// or the explicit text of a user notice.
+type CertificatePolicyQualifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// valid checks the qualifier's type and value.
+func (q CertificatePolicyQualifier) valid() error {
+	switch q.Type {
+	case CPSQualifierType:
+		u, err := url.Parse(q.Value)
+		if err != nil {
+			return err
+		}
+		if !u.IsAbs() {
+			return errors.New("CPS qualifier must be an absolute URI")
+		}
+		for _, c := range q.Value {
+			if c > 0x7f {
+				return errors.New("CPS qualifier must be ASCII")
+			}
+		}
+	case UserNoticeQualifierType:
+		// RFC 5280 limits explicit text to 200 characters.
+		if q.Value == "" || len([]rune(q.Value)) > 200 {
+			return errors.New("user notice text must be between 1 and 200 characters")
+		}
+	default:
+		return errors.New("unknown policy qualifier type " + q.Type)
+	}
+	return nil
+}
+
+// An Extension is an extension added to every certificate signed
+// under a profile. Its value is the DER encoding of the extension
+// value, encoded as hex (the default) or, if Encoding is "base64", as
+// base64. An extension overrides one with the same OID that would
+// otherwise be generated from the profile.
+type Extension struct {
+	ID       string `json:"id"`
+	Critical bool   `json:"critical"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// parse decodes and checks the value of the extension, whose ID has
+// already been parsed into oid.
+func (e Extension) parse(oid asn1.ObjectIdentifier) (pkix.Extension, error) {
+	var ext pkix.Extension
+	var value []byte
+	var err error
+	switch e.Encoding {
+	case "", "hex":
+		value, err = hex.DecodeString(e.Value)
+	case "base64":
+		value, err = base64.StdEncoding.DecodeString(e.Value)
+	default:
+		err = errors.New("unknown extension value encoding " + e.Encoding)
+	}
+	if err != nil {
+		return ext, err
+	}
+
+	var raw asn1.RawValue
+	if rest, err := asn1.Unmarshal(value, &raw); err != nil {
+		return ext, err
+	} else if len(rest) != 0 {
+		return ext, errors.New("trailing data after extension value of " + e.ID)
+	}
+
+	return pkix.Extension{Id: oid, Critical: e.Critical, Value: value}, nil
 }
 
 // A SigningProfile stores information that the CA needs to store
@@ -40,7 +247,6 @@ type SigningProfile struct {
 	OCSP           string    `json:"ocsp_url"`
 	CRL            string    `json:"crl_url"`
 	CA             bool      `json:"is_ca"`
-	PolicyStrings  []string  `json:"policies"`
 	OCSPNoCheck    bool      `json:"ocsp_no_check"`
 	ExpiryString   string    `json:"expiry"`
 	BackdateString string    `json:"backdate"`
@@ -49,23 +255,159 @@ type SigningProfile struct {
 	NotBefore      time.Time `json:"not_before"`
 	NotAfter       time.Time `json:"not_after"`
 
-	Policies     []asn1.ObjectIdentifier
-	Expiry       time.Duration
-	Backdate     time.Duration
-	Provider     auth.Provider
-	RemoteServer string
-	UseSerialSeq bool
-	CSRWhitelist *CSRWhitelist
+	CertificatePolicies []CertificatePolicy `json:"policies"`
+	NameConstraints     *NameConstraints    `json:"name_constraints"`
+	AllowedNames        *AllowedNames       `json:"allowed_names"`
+	ExtensionSpecs      []Extension         `json:"extensions"`
+
+	AllowedKeyAlgorithms     []string       `json:"allowed_key_algorithms"`
+	MinKeySize               map[string]int `json:"min_key_size"`
+	SignatureAlgorithmString string         `json:"signature_algorithm"`
+	SerialLength             int            `json:"serial_length"`
+	CTLogServers             []string       `json:"ct_log_servers"`
+	CTLogKeys                []string       `json:"ct_log_keys"`
+	Inherits                 string         `json:"inherits"`
+
+	// PolicyStrings holds bare policy OIDs set by Go callers.
+	//
+	// Deprecated: use CertificatePolicies. populate moves these
+	// into CertificatePolicies.
+	PolicyStrings []string `json:"-"`
+
+	Policies           []asn1.ObjectIdentifier
+	Extensions         []pkix.Extension
+	CTLogPublicKeys    []crypto.PublicKey
+	SignatureAlgorithm x509.SignatureAlgorithm
+	Expiry             time.Duration
+	Backdate           time.Duration
+	Provider           auth.Provider
+	RemoteServer       string
+	UseSerialSeq       bool
+	CSRWhitelist       *CSRWhitelist
 }
 
-func parseObjectIdentifier(oidString string) (oid asn1.ObjectIdentifier, err error) {
-	validOID, err := regexp.MatchString("\\d(\\.\\d+)*", oidString)
-	if err != nil {
-		return
+// The variables that may appear, in braces, in a profile's issuer,
+// OCSP and CRL URLs. They expand, per signer, to the signer's label
+// and to the subject key identifier (in hex) and serial number (in
+// decimal) of its CA certificate, so that one policy can serve several
+// roots.
+const (
+	LabelURLVar        = "label"
+	IssuerSKIURLVar    = "ski"
+	IssuerSerialURLVar = "serial"
+)
+
+var urlVarRegexp = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// validURLTemplate checks that a URL only uses known variables.
+func validURLTemplate(tmpl string) error {
+	for _, m := range urlVarRegexp.FindAllStringSubmatch(tmpl, -1) {
+		switch m[1] {
+		case LabelURLVar, IssuerSKIURLVar, IssuerSerialURLVar:
+		default:
+			return errors.New("unknown variable " + m[0] + " in URL " + tmpl)
+		}
+	}
+	return nil
+}
+
+// ExpandURL substitutes vars, keyed by variable name, into a templated
+// URL. Unknown variables are left as they are.
+func ExpandURL(tmpl string, vars map[string]string) string {
+	return urlVarRegexp.ReplaceAllStringFunc(tmpl, func(m string) string {
+		if v, ok := vars[m[1:len(m)-1]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// Key algorithms, as named in allowed_key_algorithms and min_key_size.
+const (
+	RSAKeyAlgorithm     = "rsa"
+	ECDSAKeyAlgorithm   = "ecdsa"
+	Ed25519KeyAlgorithm = "ed25519"
+)
+
+// KeyAlgorithm returns the name of the algorithm of a public key, or
+// an empty string if the algorithm is not supported.
+func KeyAlgorithm(pub interface{}) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return RSAKeyAlgorithm
+	case *ecdsa.PublicKey:
+		return ECDSAKeyAlgorithm
+	case ed25519.PublicKey:
+		return Ed25519KeyAlgorithm
+	default:
+		return ""
 	}
-	if !validOID {
-		err = errors.New("Invalid OID")
-		return
+}
+
+func validKeyAlgorithm(algo string) bool {
+	return algo == RSAKeyAlgorithm || algo == ECDSAKeyAlgorithm || algo == Ed25519KeyAlgorithm
+}
+
+// signatureAlgorithms are the algorithms a profile may choose with
+// signature_algorithm.
+var signatureAlgorithms = []x509.SignatureAlgorithm{
+	x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+	x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS,
+	x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512,
+	x509.PureEd25519,
+}
+
+// parseSignatureAlgorithm looks up a signature algorithm by the name
+// helpers.SignatureString gives it, ignoring case.
+func parseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	for _, algo := range signatureAlgorithms {
+		if strings.EqualFold(name, helpers.SignatureString(algo)) {
+			return algo, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, errors.New("unsupported signature algorithm " + name)
+}
+
+// populateKeyPolicy validates the profile's key algorithm, key size
+// and signature algorithm settings.
+func (p *SigningProfile) populateKeyPolicy(path string) FieldErrors {
+	var errs FieldErrors
+	for i, algo := range p.AllowedKeyAlgorithms {
+		if !validKeyAlgorithm(algo) {
+			errs.add(fieldPath(path, fmt.Sprintf("allowed_key_algorithms[%d]", i)),
+				errors.New("unknown key algorithm "+algo))
+		}
+	}
+
+	algos := make([]string, 0, len(p.MinKeySize))
+	for algo := range p.MinKeySize {
+		algos = append(algos, algo)
+	}
+	sort.Strings(algos)
+	for _, algo := range algos {
+		if !validKeyAlgorithm(algo) {
+			errs.add(fieldPath(path, "min_key_size."+algo), errors.New("unknown key algorithm "+algo))
+		} else if p.MinKeySize[algo] <= 0 {
+			errs.add(fieldPath(path, "min_key_size."+algo), errors.New("minimum key size must be positive"))
+		}
+	}
+
+	p.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+	if p.SignatureAlgorithmString != "" {
+		algo, err := parseSignatureAlgorithm(p.SignatureAlgorithmString)
+		if err != nil {
+			errs.add(fieldPath(path, "signature_algorithm"), err)
+		}
+		p.SignatureAlgorithm = algo
+	}
+	return errs
+}
+
+var oidRegexp = regexp.MustCompile(`^[0-2](\.\d+)+$`)
+
+func parseObjectIdentifier(oidString string) (oid asn1.ObjectIdentifier, err error) {
+	if !oidRegexp.MatchString(oidString) {
+		return nil, errors.New("invalid OID " + oidString)
 	}
 
 	segments := strings.Split(oidString, ".")
@@ -73,14 +415,138 @@ func parseObjectIdentifier(oidString string) (oid asn1.ObjectIdentifier, err err
 	for i, intString := range segments {
 		oid[i], err = strconv.Atoi(intString)
 		if err != nil {
-			return
+			return nil, errors.New("invalid OID " + oidString)
 		}
 	}
-	return
+
+	// Under the arcs 0 and 1, X.660 allows at most 40 second arcs.
+	if oid[0] < 2 && oid[1] > 39 {
+		return nil, errors.New("invalid OID " + oidString + ": second arc must be below 40")
+	}
+	return oid, nil
+}
+
+// parseCTLogKey parses a CT log's public key, the base64 encoding of
+// its DER SubjectPublicKeyInfo.
+func parseCTLogKey(key string) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.New("invalid CT log key: " + err.Error())
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.New("invalid CT log key: " + err.Error())
+	}
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return pub, nil
+	default:
+		return nil, errors.New("CT log keys must be ECDSA or RSA")
+	}
 }
 
 const timeFormat = "2006-01-02T15:04:05"
 
+var dnsDomainRegexp = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+
+// validConstraintDomain checks a DNS domain used in a name constraint.
+// A leading period is allowed when allowDot is set.
+func validConstraintDomain(domain string, allowDot bool) bool {
+	if allowDot {
+		domain = strings.TrimPrefix(domain, ".")
+	}
+	return len(domain) <= 253 && dnsDomainRegexp.MatchString(domain)
+}
+
+// parseIPRanges parses a list of CIDR ranges, rejecting any with host
+// bits set.
+func parseIPRanges(ranges []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, r := range ranges {
+		ip, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, err
+		}
+		if !ip.Equal(ipNet.IP) {
+			return nil, errors.New("IP range has host bits set: " + r)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// populate validates the name constraints and parses their IP ranges.
+func (nc *NameConstraints) populate() error {
+	for _, domains := range [][]string{nc.PermittedDNSDomains, nc.ExcludedDNSDomains} {
+		for _, domain := range domains {
+			if !validConstraintDomain(domain, false) {
+				return errors.New("invalid DNS name constraint: " + domain)
+			}
+		}
+	}
+
+	for _, emails := range [][]string{nc.PermittedEmailAddresses, nc.ExcludedEmailAddresses} {
+		for _, email := range emails {
+			valid := false
+			if at := strings.LastIndex(email, "@"); at >= 0 {
+				valid = at > 0 && !strings.ContainsAny(email[:at], " @") &&
+					validConstraintDomain(email[at+1:], false)
+			} else {
+				valid = validConstraintDomain(email, true)
+			}
+			if !valid {
+				return errors.New("invalid email name constraint: " + email)
+			}
+		}
+	}
+
+	var err error
+	if nc.PermittedIPNets, err = parseIPRanges(nc.PermittedIPRanges); err != nil {
+		return err
+	}
+	if nc.ExcludedIPNets, err = parseIPRanges(nc.ExcludedIPRanges); err != nil {
+		return err
+	}
+	return nil
+}
+
+// A FieldError is a problem with one field of a configuration. Field
+// is the path to the field, such as signing.profiles.server.expiry.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return e.Err.Error()
+	}
+	return e.Field + ": " + e.Err.Error()
+}
+
+// FieldErrors lists the problems found in a configuration.
+type FieldErrors []*FieldError
+
+func (errs FieldErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (errs *FieldErrors) add(field string, err error) {
+	*errs = append(*errs, &FieldError{Field: field, Err: err})
+}
+
+// fieldPath returns the path to field within the object at path.
+func fieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
 // populate is used to fill in the fields that are not in JSON
 //
 // First, the ExpiryString parameter is needed to parse
@@ -90,60 +556,171 @@ const timeFormat = "2006-01-02T15:04:05"
 // Expiry parameter.
 // This function is also used to create references to the auth key
 // and default remote for the profile.
-// It returns true if ExpiryString is a valid representation of a
+// It returns nil if ExpiryString is a valid representation of a
 // time.Duration, and the AuthKeyString and RemoteName point to
-// valid objects. It returns false otherwise.
+// valid objects. Otherwise it returns an error listing every problem.
 func (p *SigningProfile) populate(cfg *Config) error {
+	if errs := p.populateFields(cfg, ""); len(errs) != 0 {
+		return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, errs)
+	}
+	return nil
+}
+
+// populateFields does the work of populate, returning each problem
+// under its field path, which starts with path.
+func (p *SigningProfile) populateFields(cfg *Config, path string) FieldErrors {
+	var errs FieldErrors
 	if p == nil {
-		return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, errors.New("can't parse nil profile"))
+		errs.add(path, errors.New("missing profile"))
+		return errs
 	}
 
-	var err error
 	if p.RemoteName == "" {
 		log.Debugf("parse expiry in profile")
 		if p.ExpiryString == "" {
-			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, errors.New("empty expiry string"))
+			errs.add(fieldPath(path, "expiry"), errors.New("empty expiry string"))
+		} else if dur, err := time.ParseDuration(p.ExpiryString); err != nil {
+			errs.add(fieldPath(path, "expiry"), err)
+		} else {
+			log.Debugf("expiry is valid")
+			p.Expiry = dur
 		}
 
-		dur, err := time.ParseDuration(p.ExpiryString)
-		if err != nil {
-			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+		if p.BackdateString != "" {
+			dur, err := time.ParseDuration(p.BackdateString)
+			if err != nil {
+				errs.add(fieldPath(path, "backdate"), err)
+			} else {
+				p.Backdate = dur
+			}
 		}
 
-		log.Debugf("expiry is valid")
-		p.Expiry = dur
+		if !p.NotBefore.IsZero() && !p.NotAfter.IsZero() && p.NotAfter.Before(p.NotBefore) {
+			errs.add(fieldPath(path, "not_after"), errors.New("not_after is before not_before"))
+		}
 
-		if p.BackdateString != "" {
-			dur, err = time.ParseDuration(p.BackdateString)
+		for i, u := range p.Usage {
+			if _, ok := KeyUsage[u]; ok {
+				continue
+			}
+			if _, ok := ExtKeyUsage[u]; !ok {
+				errs.add(fieldPath(path, fmt.Sprintf("usages[%d]", i)), errors.New("unknown usage "+u))
+			}
+		}
+
+		for _, oidString := range p.PolicyStrings {
+			p.CertificatePolicies = append(p.CertificatePolicies, CertificatePolicy{ID: oidString})
+		}
+		p.PolicyStrings = nil
+
+		if len(p.CertificatePolicies) > 0 {
+			p.Policies = make([]asn1.ObjectIdentifier, len(p.CertificatePolicies))
+			for i, policy := range p.CertificatePolicies {
+				policyPath := fieldPath(path, fmt.Sprintf("policies[%d]", i))
+				var err error
+				if p.Policies[i], err = parseObjectIdentifier(policy.ID); err != nil {
+					errs.add(policyPath+".id", err)
+				}
+				for j, q := range policy.Qualifiers {
+					if err = q.valid(); err != nil {
+						errs.add(fmt.Sprintf("%s.qualifiers[%d]", policyPath, j), err)
+					}
+				}
+			}
+		}
+
+		p.Extensions = nil
+		for i, spec := range p.ExtensionSpecs {
+			extPath := fieldPath(path, fmt.Sprintf("extensions[%d]", i))
+			oid, err := parseObjectIdentifier(spec.ID)
 			if err != nil {
-				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+				errs.add(extPath+".id", err)
+				continue
 			}
+			ext, err := spec.parse(oid)
+			if err != nil {
+				errs.add(extPath, err)
+				continue
+			}
+			duplicate := false
+			for _, other := range p.Extensions {
+				if other.Id.Equal(ext.Id) {
+					duplicate = true
+				}
+			}
+			if duplicate {
+				errs.add(extPath, errors.New("duplicate extension "+spec.ID))
+				continue
+			}
+			p.Extensions = append(p.Extensions, ext)
+		}
 
-			p.Backdate = dur
+		if p.NameConstraints != nil {
+			if !p.CA {
+				errs.add(fieldPath(path, "name_constraints"), errors.New("name constraints require is_ca"))
+			}
+			if err := p.NameConstraints.populate(); err != nil {
+				errs.add(fieldPath(path, "name_constraints"), err)
+			}
 		}
 
-		if !p.NotBefore.IsZero() && !p.NotAfter.IsZero() && p.NotAfter.Before(p.NotBefore) {
-			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+		if p.AllowedNames != nil {
+			if err := p.AllowedNames.populate(); err != nil {
+				errs.add(fieldPath(path, "allowed_names"), err)
+			}
+		}
+
+		errs = append(errs, p.populateKeyPolicy(path)...)
+
+		// Serial numbers need at least 64 random bits, and at most
+		// 19 random bytes fit in the 20 bytes RFC 5280 allows.
+		if p.SerialLength != 0 && (p.SerialLength < 8 || p.SerialLength > 19) {
+			errs.add(fieldPath(path, "serial_length"), errors.New("serial_length must be between 8 and 19 bytes"))
+		}
+
+		if err := validURLTemplate(p.OCSP); err != nil {
+			errs.add(fieldPath(path, "ocsp_url"), err)
+		}
+		if err := validURLTemplate(p.CRL); err != nil {
+			errs.add(fieldPath(path, "crl_url"), err)
+		}
+		for i, u := range p.IssuerURL {
+			if err := validURLTemplate(u); err != nil {
+				errs.add(fieldPath(path, fmt.Sprintf("issuer_urls[%d]", i)), err)
+			}
 		}
 
-		if len(p.PolicyStrings) > 0 {
-			p.Policies = make([]asn1.ObjectIdentifier, len(p.PolicyStrings))
-			for i, oidString := range p.PolicyStrings {
-				p.Policies[i], err = parseObjectIdentifier(oidString)
+		for i, server := range p.CTLogServers {
+			u, err := url.Parse(server)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs.add(fieldPath(path, fmt.Sprintf("ct_log_servers[%d]", i)), errors.New("invalid CT log server "+server))
+			}
+		}
+		// Each log's key, base64-encoded DER as logs publish it, is
+		// needed to check the SCTs the log returns.
+		if len(p.CTLogKeys) != len(p.CTLogServers) {
+			errs.add(fieldPath(path, "ct_log_keys"), fmt.Errorf("%d CT log keys given for %d CT log servers", len(p.CTLogKeys), len(p.CTLogServers)))
+		} else {
+			p.CTLogPublicKeys = nil
+			for i, key := range p.CTLogKeys {
+				pub, err := parseCTLogKey(key)
 				if err != nil {
-					return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+					errs.add(fieldPath(path, fmt.Sprintf("ct_log_keys[%d]", i)), err)
+					continue
 				}
+				p.CTLogPublicKeys = append(p.CTLogPublicKeys, pub)
 			}
 		}
 	} else {
 		log.Debug("match remote in profile to remotes section")
 		if remote := cfg.Remotes[p.RemoteName]; remote != "" {
-			if err := p.updateRemote(remote); err != nil {
-				return err
+			if remote, err := ResolveSecret(remote); err != nil {
+				errs.add("remotes."+p.RemoteName, err)
+			} else if err = p.updateRemote(remote); err != nil {
+				errs.add(fieldPath(path, "remote"), err)
 			}
 		} else {
-			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-				errors.New("failed to find remote in remotes section"))
+			errs.add(fieldPath(path, "remote"), errors.New("failed to find remote "+p.RemoteName+" in remotes section"))
 		}
 	}
 
@@ -151,24 +728,23 @@ func (p *SigningProfile) populate(cfg *Config) error {
 		log.Debug("match auth key in profile to auth_keys section")
 		if key, ok := cfg.AuthKeys[p.AuthKeyName]; ok == true {
 			if key.Type == "standard" {
-				p.Provider, err = auth.New(key.Key, nil)
+				secret, err := ResolveSecret(key.Key)
 				if err != nil {
+					errs.add("auth_keys."+p.AuthKeyName+".key", err)
+				} else if p.Provider, err = auth.New(secret, nil); err != nil {
 					log.Debugf("failed to create new standard auth provider: %v", err)
-					return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-						errors.New("failed to create new standard auth provider"))
+					errs.add(fieldPath(path, "auth_key"), errors.New("failed to create new standard auth provider"))
 				}
 			} else {
 				log.Debugf("unknown authentication type %v", key.Type)
-				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-					errors.New("unknown authentication type"))
+				errs.add(fieldPath(path, "auth_key"), errors.New("unknown authentication type "+key.Type))
 			}
 		} else {
-			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-				errors.New("failed to find auth_key in auth_keys section"))
+			errs.add(fieldPath(path, "auth_key"), errors.New("failed to find auth_key "+p.AuthKeyName+" in auth_keys section"))
 		}
 	}
 
-	return nil
+	return errs
 }
 
 // updateRemote takes a signing profile and initializes the remote server object
@@ -250,42 +826,47 @@ func (p *SigningProfile) Usages() (ku x509.KeyUsage, eku []x509.ExtKeyUsage, unk
 // In addition, a remote profile must has a valid auth provider if auth
 // key defined.
 func (p *SigningProfile) validProfile(isDefault bool) bool {
+	errs := p.validate(isDefault, "")
+	for _, e := range errs {
+		log.Debugf("invalid profile: %v", e)
+	}
+	return len(errs) == 0
+}
+
+// validate returns the reasons, if any, that the profile at path is
+// not valid.
+func (p *SigningProfile) validate(isDefault bool, path string) FieldErrors {
+	var errs FieldErrors
 	if p == nil {
-		return false
+		errs.add(path, errors.New("missing profile"))
+		return errs
 	}
 
 	if p.RemoteName != "" {
 		log.Debugf("validate remote profile")
 
 		if p.RemoteServer == "" {
-			log.Debugf("invalid remote profile: no remote signer specified")
-			return false
+			errs.add(fieldPath(path, "remote"), errors.New("no remote signer specified"))
 		}
 
 		if p.AuthKeyName != "" && p.Provider == nil {
-			log.Debugf("invalid remote profile: auth key name is defined but no auth provider is set")
-			return false
+			errs.add(fieldPath(path, "auth_key"), errors.New("auth key name is defined but no auth provider is set"))
 		}
 	} else {
 		log.Debugf("validate local profile")
 		if !isDefault {
 			if len(p.Usage) == 0 {
-				log.Debugf("invalid local profile: no usages specified")
-				return false
+				errs.add(fieldPath(path, "usages"), errors.New("no usages specified"))
 			} else if _, _, unk := p.Usages(); len(unk) == len(p.Usage) {
-				log.Debugf("invalid local profile: no valid usages")
-				return false
+				errs.add(fieldPath(path, "usages"), errors.New("no valid usages"))
 			}
 		} else {
 			if p.Expiry == 0 {
-				log.Debugf("invalid local profile: no expiry set")
-				return false
+				errs.add(fieldPath(path, "expiry"), errors.New("no expiry set"))
 			}
 		}
 	}
-
-	log.Debugf("profile is valid")
-	return true
+	return errs
 }
 
 // Signing codifies the signature configuration policy for a CA.
@@ -312,23 +893,38 @@ func (c *Config) Valid() bool {
 // to be used, and a valid default profile has defined at least a
 // default expiration.
 func (p *Signing) Valid() bool {
+	log.Debugf("validating configuration")
+	errs := p.validate()
+	for _, e := range errs {
+		log.Debugf("invalid configuration: %v", e)
+	}
+	return len(errs) == 0
+}
+
+// validate returns the reasons, if any, that the policies are not
+// valid, in a stable order.
+func (p *Signing) validate() FieldErrors {
+	var errs FieldErrors
 	if p == nil {
-		return false
+		errs.add("signing", errors.New("missing signing section"))
+		return errs
 	}
 
-	log.Debugf("validating configuration")
-	if !p.Default.validProfile(true) {
-		log.Debugf("default profile is invalid")
-		return false
+	errs = append(errs, p.Default.validate(true, "signing.default")...)
+	for _, name := range p.profileNames() {
+		errs = append(errs, p.Profiles[name].validate(false, "signing.profiles."+name)...)
 	}
+	return errs
+}
 
-	for _, sp := range p.Profiles {
-		if !sp.validProfile(false) {
-			log.Debugf("invalid profile")
-			return false
-		}
+// profileNames returns the names of the profiles in sorted order.
+func (p *Signing) profileNames() []string {
+	names := make([]string, 0, len(p.Profiles))
+	for name := range p.Profiles {
+		names = append(names, name)
 	}
-	return true
+	sort.Strings(names)
+	return names
 }
 
 // KeyUsage contains a mapping of string names to key usages.
@@ -370,10 +966,45 @@ type AuthKey struct {
 	// IP.
 	Type string `json:"type"`
 	// Key contains the key information, such as a hex-encoded
-	// HMAC key.
+	// HMAC key, or a reference to it as described for ResolveSecret.
 	Key string `json:"key"`
 }
 
+// Prefixes of references to secrets kept outside the configuration.
+const (
+	EnvSecretPrefix  = "env:"
+	FileSecretPrefix = "file:"
+)
+
+// ResolveSecret returns the secret that ref refers to. A ref of
+// env:NAME refers to the value of the environment variable NAME, and
+// file:/path to the contents of the file at path, less surrounding
+// whitespace. Any other ref is the secret itself.
+func ResolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, EnvSecretPrefix):
+		name := strings.TrimPrefix(ref, EnvSecretPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok || secret == "" {
+			return "", errors.New("environment variable " + name + " is not set")
+		}
+		return secret, nil
+	case strings.HasPrefix(ref, FileSecretPrefix):
+		path := strings.TrimPrefix(ref, FileSecretPrefix)
+		in, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		secret := strings.TrimSpace(string(in))
+		if secret == "" {
+			return "", errors.New("secret file " + path + " is empty")
+		}
+		return secret, nil
+	default:
+		return ref, nil
+	}
+}
+
 // DefaultConfig returns a default configuration specifying basic key
 // usage and a 1 year expiration time. The key usages chosen are
 // signing, key encipherment, client auth and server auth.
@@ -402,35 +1033,176 @@ func LoadFile(path string) (*Config, error) {
 	return LoadConfig(body)
 }
 
+// inheritProfiles applies the inherits keys of the profiles in the
+// JSON configuration config, whose parsed profiles are given. A
+// profile that inherits from another takes every key of that profile,
+// after its own inheritance, that it doesn't set itself. Keys are
+// taken whole: a profile that sets usages replaces the inherited
+// usages rather than adding to them.
+func inheritProfiles(config []byte, profiles map[string]*SigningProfile) FieldErrors {
+	var errs FieldErrors
+	var raw struct {
+		Signing struct {
+			Profiles map[string]map[string]json.RawMessage `json:"profiles"`
+		} `json:"signing"`
+	}
+	if err := json.Unmarshal(config, &raw); err != nil {
+		errs.add("signing.profiles", err)
+		return errs
+	}
+
+	resolved := map[string]map[string]json.RawMessage{}
+	var resolve func(name string, chain []string) (map[string]json.RawMessage, error)
+	resolve = func(name string, chain []string) (map[string]json.RawMessage, error) {
+		if fields, ok := resolved[name]; ok {
+			return fields, nil
+		}
+		for _, n := range chain {
+			if n == name {
+				return nil, errors.New("profile inheritance cycle: " + strings.Join(append(chain, name), " -> "))
+			}
+		}
+
+		fields := raw.Signing.Profiles[name]
+		var parentName string
+		if v, ok := fields["inherits"]; ok {
+			if err := json.Unmarshal(v, &parentName); err != nil {
+				return nil, err
+			}
+		}
+		if parentName == "" {
+			resolved[name] = fields
+			return fields, nil
+		}
+		if _, ok := raw.Signing.Profiles[parentName]; !ok {
+			return nil, fmt.Errorf("profile %s inherits from unknown profile %s", name, parentName)
+		}
+
+		parent, err := resolve(parentName, append(chain, name))
+		if err != nil {
+			return nil, err
+		}
+		merged := make(map[string]json.RawMessage, len(parent)+len(fields))
+		for k, v := range parent {
+			merged[k] = v
+		}
+		for k, v := range fields {
+			merged[k] = v
+		}
+		resolved[name] = merged
+		return merged, nil
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if profiles[name] == nil || profiles[name].Inherits == "" {
+			continue
+		}
+		path := "signing.profiles." + name + ".inherits"
+		fields, err := resolve(name, nil)
+		if err != nil {
+			errs.add(path, err)
+			continue
+		}
+		effective, err := json.Marshal(fields)
+		if err != nil {
+			errs.add(path, err)
+			continue
+		}
+		log.Debugf("profile %s inherits from %s; effective profile: %s", name, profiles[name].Inherits, effective)
+
+		var p SigningProfile
+		if err = json.Unmarshal(effective, &p); err != nil {
+			errs.add(path, err)
+			continue
+		}
+		profiles[name] = &p
+	}
+	return errs
+}
+
 // LoadConfig attempts to load the configuration from a byte slice.
-// On error, it returns nil.
+// Profiles that inherit from others are merged with them before they
+// are checked, and the effective profiles are logged at debug level.
+// On error, it returns nil, and the error lists every problem found.
 func LoadConfig(config []byte) (*Config, error) {
+	cfg, errs := loadConfig(config)
+	if len(errs) != 0 {
+		return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, errs)
+	}
+
+	log.Debugf("configuration ok")
+	return cfg, nil
+}
+
+// CheckConfig checks the configuration in a byte slice as LoadConfig
+// does, and returns every problem found, each naming the field at
+// fault.
+func CheckConfig(config []byte) FieldErrors {
+	_, errs := loadConfig(config)
+	return errs
+}
+
+func loadConfig(config []byte) (*Config, FieldErrors) {
+	var errs FieldErrors
 	var cfg = &Config{}
-	err := json.Unmarshal(config, &cfg)
-	if err != nil {
-		return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
-			errors.New("failed to unmarshal configuration: " + err.Error()))
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		errs.add("", errors.New("failed to unmarshal configuration: "+err.Error()))
+		return nil, errs
 	}
 
+	if cfg.Signing == nil {
+		errs.add("signing", errors.New("missing signing section"))
+		return nil, errs
+	}
+
+	if cfg.Signing.Default != nil && cfg.Signing.Default.Inherits != "" {
+		errs.add("signing.default.inherits", errors.New("the default profile can't inherit from another profile"))
+	}
+	errs = append(errs, inheritProfiles(config, cfg.Signing.Profiles)...)
+
 	if cfg.Signing.Default == nil {
 		log.Debugf("no default given: using default config")
 		cfg.Signing.Default = DefaultConfig()
 	} else {
-		if err := cfg.Signing.Default.populate(cfg); err != nil {
-			return nil, err
-		}
+		errs = append(errs, cfg.Signing.Default.populateFields(cfg, "signing.default")...)
 	}
 
-	for k := range cfg.Signing.Profiles {
-		if err := cfg.Signing.Profiles[k].populate(cfg); err != nil {
-			return nil, err
+	for _, name := range cfg.Signing.profileNames() {
+		errs = append(errs, cfg.Signing.Profiles[name].populateFields(cfg, "signing.profiles."+name)...)
+	}
+
+	// Profiles that share an auth key or remote report the same
+	// problems with it, which are only listed once.
+	var unique FieldErrors
+	seen := map[string]bool{}
+	for _, e := range errs {
+		if msg := e.Error(); !seen[msg] {
+			seen[msg] = true
+			unique = append(unique, e)
 		}
 	}
+	errs = unique
 
-	if !cfg.Valid() {
-		return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, errors.New("invalid configuration"))
+	// A field that failed to load usually fails validation too, so
+	// only the first problem with each field is reported.
+	reported := map[string]bool{}
+	for _, e := range errs {
+		reported[e.Field] = true
+	}
+	for _, e := range cfg.Signing.validate() {
+		if !reported[e.Field] {
+			errs = append(errs, e)
+		}
 	}
 
-	log.Debugf("configuration ok")
+	if len(errs) != 0 {
+		return nil, errs
+	}
 	return cfg, nil
 }
@@ -1,10 +1,22 @@
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/cloudflare/cfssl/auth"
 )
 
 var expiry = 1 * time.Minute
@@ -335,3 +347,449 @@ func TestOverrideRemotes(t *testing.T) {
 	}
 
 }
+
+func TestNameConstraints(t *testing.T) {
+	var validConstraints = []*NameConstraints{
+		{PermittedDNSDomains: []string{"example.com", "internal"}},
+		{ExcludedDNSDomains: []string{"bad.example.com"}},
+		{PermittedIPRanges: []string{"10.0.0.0/8", "2001:db8::/32"}},
+		{PermittedEmailAddresses: []string{"user@example.com", "example.com", ".example.com"}},
+	}
+
+	var invalidConstraints = []*NameConstraints{
+		{PermittedDNSDomains: []string{"*.example.com"}},
+		{PermittedDNSDomains: []string{".example.com"}},
+		{ExcludedDNSDomains: []string{"example..com"}},
+		{PermittedIPRanges: []string{"10.0.0.0"}},
+		{ExcludedIPRanges: []string{"10.0.0.1/8"}},
+		{PermittedEmailAddresses: []string{"@example.com"}},
+		{ExcludedEmailAddresses: []string{"user@"}},
+	}
+
+	for _, nc := range validConstraints {
+		p := &SigningProfile{ExpiryString: "8760h", CA: true, NameConstraints: nc}
+		if err := p.populate(nil); err != nil {
+			t.Fatalf("Failed to parse name constraints %+v: %v", nc, err)
+		}
+	}
+
+	p := &SigningProfile{ExpiryString: "8760h", CA: true, NameConstraints: validConstraints[2]}
+	if p.populate(nil) != nil || len(p.NameConstraints.PermittedIPNets) != 2 {
+		t.Fatal("IP ranges were not parsed")
+	}
+
+	for _, nc := range invalidConstraints {
+		p := &SigningProfile{ExpiryString: "8760h", CA: true, NameConstraints: nc}
+		if p.populate(nil) == nil {
+			t.Fatalf("Name constraints %+v should not be parseable", nc)
+		}
+	}
+
+	p = &SigningProfile{ExpiryString: "8760h", NameConstraints: validConstraints[0]}
+	if p.populate(nil) == nil {
+		t.Fatal("Name constraints should require is_ca")
+	}
+}
+
+func TestAllowedNames(t *testing.T) {
+	an := &AllowedNames{
+		DNSSuffixes: []string{"example.com", ".internal"},
+		DNSPatterns: []string{"host[0-9]+\\.lan"},
+		IPRanges:    []string{"10.0.0.0/8"},
+	}
+	p := &SigningProfile{ExpiryString: "8760h", AllowedNames: an}
+	if err := p.populate(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"example.com", "WWW.Example.com", "a.internal", "host12.lan"} {
+		if !an.PermitsDNSName(name) {
+			t.Fatalf("%s should be allowed", name)
+		}
+	}
+	for _, name := range []string{"badexample.com", "internal", "host12.lan.evil.com", "xhost1.lan"} {
+		if an.PermitsDNSName(name) {
+			t.Fatalf("%s should not be allowed", name)
+		}
+	}
+
+	if !an.PermitsIP(net.ParseIP("10.1.2.3")) || an.PermitsIP(net.ParseIP("192.168.0.1")) {
+		t.Fatal("IP ranges not applied")
+	}
+
+	for _, bad := range []*AllowedNames{
+		{DNSSuffixes: []string{"*.example.com"}},
+		{DNSPatterns: []string{"("}},
+		{IPRanges: []string{"10.0.0.0/33"}},
+	} {
+		p := &SigningProfile{ExpiryString: "8760h", AllowedNames: bad}
+		if p.populate(nil) == nil {
+			t.Fatalf("allowed names %+v should not be parseable", bad)
+		}
+	}
+}
+
+func TestPoliciesAndExtensions(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{
+		"signing": {
+			"default": {
+				"usages": ["digital signature"],
+				"expiry": "1h",
+				"policies": [
+					"2.23.140.1.2.1",
+					{
+						"id": "1.3.6.1.4.1.44947.1.1.1",
+						"qualifiers": [
+							{"type": "id-qt-cps", "value": "http://cps.example.com"},
+							{"type": "id-qt-unotice", "value": "For internal use only"}
+						]
+					}
+				],
+				"extensions": [
+					{"id": "1.3.6.1.4.1.99999.1", "critical": true, "value": "0500"},
+					{"id": "1.3.6.1.4.1.99999.2", "value": "DAVoZWxsbw==", "encoding": "base64"}
+				]
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := cfg.Signing.Default
+	if len(p.Policies) != 2 || len(p.CertificatePolicies[1].Qualifiers) != 2 {
+		t.Fatalf("policies not parsed: %+v", p.CertificatePolicies)
+	}
+	if len(p.Extensions) != 2 || !p.Extensions[0].Critical || string(p.Extensions[1].Value[2:]) != "hello" {
+		t.Fatalf("extensions not parsed: %+v", p.Extensions)
+	}
+
+	legacy := &SigningProfile{
+		ExpiryString:        "1h",
+		CertificatePolicies: []CertificatePolicy{{ID: "1.2.3"}},
+		PolicyStrings:       []string{"2.23.140.1.2.1"},
+	}
+	if err = legacy.populate(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = legacy.populate(nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(legacy.Policies) != 2 || !legacy.Policies[1].Equal(asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}) {
+		t.Fatalf("policy strings not folded into policies: %v", legacy.Policies)
+	}
+
+	var invalidProfiles = []*SigningProfile{
+		{PolicyStrings: []string{"1.2.x"}},
+		{CertificatePolicies: []CertificatePolicy{{ID: "1.2.3", Qualifiers: []CertificatePolicyQualifier{{Type: "id-qt-cps", Value: "not a uri"}}}}},
+		{CertificatePolicies: []CertificatePolicy{{ID: "1.2.3", Qualifiers: []CertificatePolicyQualifier{{Type: "id-qt-unotice"}}}}},
+		{CertificatePolicies: []CertificatePolicy{{ID: "1.2.3", Qualifiers: []CertificatePolicyQualifier{{Type: "other", Value: "x"}}}}},
+		{ExtensionSpecs: []Extension{{ID: "1.2.3", Value: "zz"}}},
+		{ExtensionSpecs: []Extension{{ID: "1.2.3", Value: "0500ff"}}},
+		{ExtensionSpecs: []Extension{{ID: "1.2.3", Value: "0500", Encoding: "base32"}}},
+		{ExtensionSpecs: []Extension{{ID: "1.2.3", Value: "0500"}, {ID: "1.2.3", Value: "0500"}}},
+	}
+	for _, p := range invalidProfiles {
+		p.ExpiryString = "1h"
+		if p.populate(nil) == nil {
+			t.Fatalf("profile %+v should not be parseable", p)
+		}
+	}
+}
+
+func TestKeyPolicy(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{
+		"signing": {
+			"default": {
+				"expiry": "8760h",
+				"allowed_key_algorithms": ["rsa", "ecdsa"],
+				"min_key_size": {"rsa": 3072, "ecdsa": 384},
+				"signature_algorithm": "ecdsawithsha384"
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := cfg.Signing.Default
+	if len(p.AllowedKeyAlgorithms) != 2 || p.MinKeySize[RSAKeyAlgorithm] != 3072 || p.MinKeySize[ECDSAKeyAlgorithm] != 384 {
+		t.Fatalf("key policy not loaded: %+v", p)
+	}
+	if p.SignatureAlgorithm != x509.ECDSAWithSHA384 {
+		t.Fatalf("expected ECDSAWithSHA384, got %v", p.SignatureAlgorithm)
+	}
+
+	for _, bad := range []*SigningProfile{
+		{AllowedKeyAlgorithms: []string{"dsa"}},
+		{MinKeySize: map[string]int{"rsa-pss": 2048}},
+		{MinKeySize: map[string]int{"rsa": -1}},
+		{SignatureAlgorithmString: "SHA1WithRSA"},
+		{SignatureAlgorithmString: "MD5WithRSA"},
+	} {
+		bad.ExpiryString = "8760h"
+		if bad.populate(nil) == nil {
+			t.Fatalf("key policy %+v should not be valid", bad)
+		}
+	}
+}
+
+func TestSerialLength(t *testing.T) {
+	for _, test := range []struct {
+		length int
+		valid  bool
+	}{
+		{0, true},
+		{8, true},
+		{19, true},
+		{7, false},
+		{20, false},
+	} {
+		p := &SigningProfile{ExpiryString: "8760h", SerialLength: test.length}
+		if err := p.populate(nil); (err == nil) != test.valid {
+			t.Fatalf("serial length %d: valid=%v, got %v", test.length, test.valid, err)
+		}
+	}
+}
+
+func TestCTLogServers(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logKey := base64.StdEncoding.EncodeToString(der)
+
+	for _, test := range []struct {
+		server string
+		keys   []string
+		valid  bool
+	}{
+		{"https://ct.example.com/log", []string{logKey}, true},
+		{"http://localhost:6962", []string{logKey}, true},
+		{"ct.example.com", []string{logKey}, false},
+		{"ftp://ct.example.com", []string{logKey}, false},
+		{"https://", []string{logKey}, false},
+		{"https://ct.example.com/log", nil, false},
+		{"https://ct.example.com/log", []string{logKey, logKey}, false},
+		{"https://ct.example.com/log", []string{"not base64"}, false},
+		{"https://ct.example.com/log", []string{base64.StdEncoding.EncodeToString([]byte("not a key"))}, false},
+	} {
+		p := &SigningProfile{ExpiryString: "8760h", CTLogServers: []string{test.server}, CTLogKeys: test.keys}
+		if err := p.populate(nil); (err == nil) != test.valid {
+			t.Fatalf("CT log server %q with %d keys: valid=%v, got %v", test.server, len(test.keys), test.valid, err)
+		}
+		if test.valid && len(p.CTLogPublicKeys) != 1 {
+			t.Fatalf("CT log server %q: expected one parsed key, got %d", test.server, len(p.CTLogPublicKeys))
+		}
+	}
+}
+
+func TestURLTemplates(t *testing.T) {
+	for _, test := range []struct {
+		url   string
+		valid bool
+	}{
+		{"http://ocsp.example.com", true},
+		{"http://ocsp.example.com/{label}", true},
+		{"http://crl.example.com/{ski}/{serial}.crl", true},
+		{"http://crl.example.com/{issuer}.crl", false},
+		{"http://crl.example.com/{}.crl", false},
+	} {
+		p := &SigningProfile{ExpiryString: "8760h", CRL: test.url}
+		if err := p.populate(nil); (err == nil) != test.valid {
+			t.Fatalf("CRL URL %q: valid=%v, got %v", test.url, test.valid, err)
+		}
+		p = &SigningProfile{ExpiryString: "8760h", IssuerURL: []string{"http://ca.example.com", test.url}}
+		if err := p.populate(nil); (err == nil) != test.valid {
+			t.Fatalf("issuer URL %q: valid=%v, got %v", test.url, test.valid, err)
+		}
+	}
+
+	vars := map[string]string{LabelURLVar: "primary", IssuerSKIURLVar: "0a0b"}
+	expanded := ExpandURL("http://ca.example.com/{label}/{ski}/{serial}", vars)
+	if expanded != "http://ca.example.com/primary/0a0b/{serial}" {
+		t.Fatalf("unexpected expansion %s", expanded)
+	}
+}
+
+func TestProfileInheritance(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{"signing": {
+		"default": {"usages": ["signing"], "expiry": "8760h"},
+		"profiles": {
+			"base": {
+				"usages": ["signing", "key encipherment"],
+				"expiry": "720h",
+				"ocsp_url": "http://ocsp.example.com",
+				"crl_url": "http://crl.example.com"
+			},
+			"server": {
+				"inherits": "base",
+				"usages": ["signing", "key encipherment", "server auth"]
+			},
+			"short": {"inherits": "server", "expiry": "24h"}
+		}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	short := cfg.Signing.Profiles["short"]
+	if short.Expiry != 24*time.Hour {
+		t.Fatalf("expected the profile's own expiry, got %v", short.Expiry)
+	}
+	if short.OCSP != "http://ocsp.example.com" || short.CRL != "http://crl.example.com" {
+		t.Fatal("URLs were not inherited through two profiles")
+	}
+	if len(short.Usage) != 3 {
+		t.Fatalf("expected the closest profile's usages, got %v", short.Usage)
+	}
+	if server := cfg.Signing.Profiles["server"]; server.Expiry != 720*time.Hour {
+		t.Fatalf("expected the inherited expiry, got %v", server.Expiry)
+	}
+	if base := cfg.Signing.Profiles["base"]; len(base.Usage) != 2 {
+		t.Fatal("inheritance changed the parent profile")
+	}
+
+	for _, bad := range []string{
+		`{"signing": {"profiles": {
+			"a": {"inherits": "b", "usages": ["signing"], "expiry": "1h"},
+			"b": {"inherits": "a", "usages": ["signing"], "expiry": "1h"}
+		}}}`,
+		`{"signing": {"profiles": {
+			"a": {"inherits": "a", "usages": ["signing"], "expiry": "1h"}
+		}}}`,
+		`{"signing": {"profiles": {
+			"a": {"inherits": "missing", "usages": ["signing"], "expiry": "1h"}
+		}}}`,
+		`{"signing": {
+			"default": {"inherits": "a", "usages": ["signing"], "expiry": "1h"},
+			"profiles": {"a": {"usages": ["signing"], "expiry": "1h"}}
+		}}`,
+	} {
+		if _, err = LoadConfig([]byte(bad)); err == nil {
+			t.Fatalf("configuration was accepted: %s", bad)
+		}
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	errs := CheckConfig([]byte(`{
+		"signing": {
+			"default": {"expiry": "8760h", "usages": ["signing"]},
+			"profiles": {
+				"a": {
+					"usages": ["signing", "wiretapping"],
+					"expiry": "1 year",
+					"policies": [{"id": "not an oid"}]
+				},
+				"b": {"remote": "missing"},
+				"c": {"usages": ["signing"], "expiry": "1h", "min_key_size": {"dsa": 1024}},
+				"d": {
+					"usages": ["signing"],
+					"expiry": "1h",
+					"policies": [{"id": "1.-2.3"}, {"id": "99.1"}, {"id": "1.40.1"}, {"id": "2.999.1"}],
+					"extensions": [{"id": "7", "value": "0500"}, {"id": "1.2.3", "value": "0500"}]
+				}
+			}
+		}
+	}`))
+
+	expected := []string{
+		"signing.profiles.a.expiry",
+		"signing.profiles.a.usages[1]",
+		"signing.profiles.a.policies[0].id",
+		"signing.profiles.b.remote",
+		"signing.profiles.c.min_key_size.dsa",
+		"signing.profiles.d.policies[0].id",
+		"signing.profiles.d.policies[1].id",
+		"signing.profiles.d.policies[2].id",
+		"signing.profiles.d.extensions[0].id",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d problems, got %v", len(expected), errs)
+	}
+	for i, field := range expected {
+		if errs[i].Field != field {
+			t.Fatalf("problem %d: expected field %s, got %v", i, field, errs[i])
+		}
+	}
+
+	// LoadConfig reports the same problems.
+	if _, err := LoadConfig([]byte(`{"signing": {"profiles": {"a": {"expiry": "1h", "usages": ["bogus"]}}}}`)); err == nil ||
+		!strings.Contains(err.Error(), "signing.profiles.a.usages[0]") {
+		t.Fatalf("expected the field in the error, got %v", err)
+	}
+
+	if errs = CheckConfig([]byte(`{}`)); len(errs) != 1 || errs[0].Field != "signing" {
+		t.Fatalf("expected a missing signing section, got %v", errs)
+	}
+}
+
+func TestSecretReferences(t *testing.T) {
+	const key = "0123456789ABCDEF0123456789ABCDEF"
+
+	f, err := ioutil.TempFile("", "cfssl-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(key + "\n")
+	f.Close()
+
+	os.Setenv("CFSSL_TEST_AUTH_KEY", key)
+	defer os.Unsetenv("CFSSL_TEST_AUTH_KEY")
+	os.Setenv("CFSSL_TEST_REMOTE", "127.0.0.1:8888")
+	defer os.Unsetenv("CFSSL_TEST_REMOTE")
+
+	for _, ref := range []string{key, "env:CFSSL_TEST_AUTH_KEY", "file:" + f.Name()} {
+		secret, err := ResolveSecret(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != key {
+			t.Fatalf("%s resolved to %q", ref, secret)
+		}
+	}
+
+	load := func(authKey, remote string) (*Config, error) {
+		return LoadConfig([]byte(`{
+			"signing": {
+				"default": {"usages": ["signing"], "expiry": "8760h"},
+				"profiles": {"remote": {"remote": "server", "auth_key": "primary"}}
+			},
+			"auth_keys": {"primary": {"type": "standard", "key": "` + authKey + `"}},
+			"remotes": {"server": "` + remote + `"}
+		}`))
+	}
+
+	cfg, err := load("file:"+f.Name(), "env:CFSSL_TEST_REMOTE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := cfg.Signing.Profiles["remote"]
+	if profile.RemoteServer != "127.0.0.1:8888" {
+		t.Fatalf("remote resolved to %s", profile.RemoteServer)
+	}
+	literal, _ := auth.New(key, nil)
+	want, _ := literal.Token([]byte("request"))
+	if got, _ := profile.Provider.Token([]byte("request")); string(got) != string(want) {
+		t.Fatal("auth key was not resolved from the file")
+	}
+
+	for _, test := range []struct {
+		authKey, remote, field string
+	}{
+		{"env:CFSSL_TEST_UNSET", "env:CFSSL_TEST_REMOTE", "auth_keys.primary.key"},
+		{"file:/nonexistent/cfssl/secret", "env:CFSSL_TEST_REMOTE", "auth_keys.primary.key"},
+		{"env:CFSSL_TEST_AUTH_KEY", "env:CFSSL_TEST_UNSET", "remotes.server"},
+	} {
+		_, err = load(test.authKey, test.remote)
+		if err == nil || !strings.Contains(err.Error(), test.field+": ") {
+			t.Fatalf("expected a problem with %s, got %v", test.field, err)
+		}
+	}
+}
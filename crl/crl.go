@@ -0,0 +1,166 @@
+// Package crl implements CRL generation for CF-SSL. A CRL is built
+// from a list of revoked serial numbers and signed with the CA's
+// certificate and private key.
+package crl
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// DefaultExpiry is the time between thisUpdate and nextUpdate used
+// when a request doesn't specify one.
+const DefaultExpiry = 7 * helpers.OneDay
+
+// A RevokedCertificate names a revoked certificate by its serial
+// number (in decimal, as recorded by the certificate store), along
+// with the RFC 5280 reason code and time of revocation.
+type RevokedCertificate struct {
+	Serial    string    `json:"serial"`
+	Reason    int       `json:"reason"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// A Request describes the CRL to be generated.
+//
+// Expiry is a duration string (such as "168h") giving the time from
+// now until the CRL's nextUpdate; it defaults to DefaultExpiry. Number
+// is the value of the CRL number extension; if it is zero, the current
+// Unix time is used, which keeps CRL numbers increasing across runs.
+type Request struct {
+	RevokedCertificates []RevokedCertificate `json:"revoked_certificates"`
+	Expiry              string               `json:"expiry,omitempty"`
+	Number              int64                `json:"number,omitempty"`
+}
+
+// A Signer is able to sign CRLs on behalf of a CA. The local signer,
+// and so any signer backed by a local or PKCS #11 key, implements it.
+type Signer interface {
+	SignCRL(req Request) ([]byte, error)
+}
+
+// validReason reports whether reason is a CRL reason code defined by
+// RFC 5280, section 5.3.1, that may appear in a full CRL. Code 7 is
+// unused, and removeFromCRL (8) is only allowed in delta CRLs.
+func validReason(reason int) bool {
+	return reason >= 0 && reason <= 10 && reason != 7 && reason != 8
+}
+
+// invalidRequest reports a problem with a CRL request, as opposed to a
+// failure to sign the CRL.
+func invalidRequest(format string, args ...interface{}) error {
+	return cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest, fmt.Errorf("crl: "+format, args...))
+}
+
+// Create builds a CRL from req and signs it with key on behalf of
+// issuer. It returns the DER-encoded CRL. The CRL carries the CRL
+// number extension and an authority key identifier taken from the
+// issuer's subject key identifier. Problems with req are returned as
+// a cferr InvalidRequest error; any other error is a failure to sign.
+func Create(issuer *x509.Certificate, key crypto.Signer, req Request) ([]byte, error) {
+	if issuer == nil || key == nil {
+		return nil, errors.New("crl: an issuer certificate and key are required")
+	}
+
+	expiry := DefaultExpiry
+	if req.Expiry != "" {
+		var err error
+		expiry, err = time.ParseDuration(req.Expiry)
+		if err != nil {
+			return nil, invalidRequest("invalid expiry: %v", err)
+		}
+	}
+	if expiry <= 0 {
+		return nil, invalidRequest("expiry must be positive")
+	}
+
+	thisUpdate := time.Now().UTC()
+	number := req.Number
+	if number == 0 {
+		number = thisUpdate.Unix()
+	}
+	if number < 0 {
+		return nil, invalidRequest("CRL number must not be negative")
+	}
+
+	entries := make([]x509.RevocationListEntry, 0, len(req.RevokedCertificates))
+	for _, rc := range req.RevokedCertificates {
+		serial, ok := new(big.Int).SetString(rc.Serial, 10)
+		if !ok {
+			return nil, invalidRequest("invalid serial number %q", rc.Serial)
+		}
+
+		if !validReason(rc.Reason) {
+			return nil, invalidRequest("invalid reason code %d for serial %s", rc.Reason, rc.Serial)
+		}
+
+		revokedAt := rc.RevokedAt
+		if revokedAt.IsZero() {
+			revokedAt = thisUpdate
+		}
+
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: revokedAt.UTC(),
+			ReasonCode:     rc.Reason,
+		})
+	}
+
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    big.NewInt(number),
+		ThisUpdate:                thisUpdate,
+		NextUpdate:                thisUpdate.Add(expiry),
+	}
+
+	crl, err := x509.CreateRevocationList(rand.Reader, template, issuer, key)
+	if err != nil {
+		return nil, fmt.Errorf("crl: failed to sign CRL: %v", err)
+	}
+
+	log.Infof("generated CRL number %d with %d entries", number, len(entries))
+	return crl, nil
+}
+
+// NewCRLFromFile reads the issuer certificate and private key from
+// PEM files and creates a CRL for req.
+func NewCRLFromFile(req Request, issuerFile, keyFile string) ([]byte, error) {
+	log.Debug("Loading issuer cert: ", issuerFile)
+	issuerBytes, err := ioutil.ReadFile(issuerFile)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Loading issuer key: ", keyFile)
+	keyBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, err := helpers.ParseCertificatePEM(issuerBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := helpers.ParsePrivateKeyPEM(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return Create(issuer, key, req)
+}
+
+// EncodePEM returns the PEM encoding of a DER-encoded CRL.
+func EncodePEM(crl []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})
+}
@@ -0,0 +1,137 @@
+package crl
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+const (
+	testCaFile    = "testdata/ca.pem"
+	testCaKeyFile = "testdata/ca-key.pem"
+)
+
+func loadIssuer(t *testing.T) *x509.Certificate {
+	certPEM, err := ioutil.ReadFile(testCaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+func TestNewCRLFromFile(t *testing.T) {
+	revokedAt := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	req := Request{
+		RevokedCertificates: []RevokedCertificate{
+			{Serial: "1234", Reason: 1, RevokedAt: revokedAt},
+			{Serial: "98765432109876543210", Reason: 4},
+		},
+		Expiry: "48h",
+		Number: 7,
+	}
+
+	der, err := NewCRLFromFile(req, testCaFile, testCaKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := loadIssuer(t)
+	if err = crl.CheckSignatureFrom(issuer); err != nil {
+		t.Fatal(err)
+	}
+
+	if crl.Number.Int64() != 7 {
+		t.Fatalf("expected CRL number 7, got %v", crl.Number)
+	}
+
+	if string(crl.AuthorityKeyId) != string(issuer.SubjectKeyId) {
+		t.Fatal("CRL authority key identifier does not match issuer")
+	}
+
+	if d := crl.NextUpdate.Sub(crl.ThisUpdate); d != 48*time.Hour {
+		t.Fatalf("expected nextUpdate 48h after thisUpdate, got %v", d)
+	}
+
+	entries := crl.RevokedCertificateEntries
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 revoked certificates, got %d", len(entries))
+	}
+	if entries[0].SerialNumber.String() != "1234" || entries[0].ReasonCode != 1 ||
+		!entries[0].RevocationTime.Equal(revokedAt) {
+		t.Fatalf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].SerialNumber.String() != "98765432109876543210" || entries[1].ReasonCode != 4 {
+		t.Fatalf("unexpected second entry: %+v", entries[1])
+	}
+}
+
+func TestCreateDefaults(t *testing.T) {
+	der, err := NewCRLFromFile(Request{}, testCaFile, testCaKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := crl.NextUpdate.Sub(crl.ThisUpdate); d != DefaultExpiry {
+		t.Fatalf("expected default expiry, got %v", d)
+	}
+	if crl.Number.Sign() <= 0 {
+		t.Fatal("expected a positive default CRL number")
+	}
+	if len(crl.RevokedCertificateEntries) != 0 {
+		t.Fatal("expected an empty CRL")
+	}
+}
+
+func TestCreateBadRequests(t *testing.T) {
+	var badRequests = []Request{
+		{RevokedCertificates: []RevokedCertificate{{Serial: "not a number"}}},
+		{RevokedCertificates: []RevokedCertificate{{Serial: "1", Reason: 7}}},
+		{RevokedCertificates: []RevokedCertificate{{Serial: "1", Reason: 8}}},
+		{RevokedCertificates: []RevokedCertificate{{Serial: "1", Reason: 11}}},
+		{Expiry: "a week"},
+		{Expiry: "-1h"},
+		{Number: -1},
+	}
+
+	for _, req := range badRequests {
+		_, err := NewCRLFromFile(req, testCaFile, testCaKeyFile)
+		if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != 5300 {
+			t.Fatalf("expected request %+v to fail as invalid, got %v", req, err)
+		}
+	}
+
+	if _, err := Create(nil, nil, Request{}); err == nil {
+		t.Fatal("expected missing issuer to fail")
+	}
+}
+
+func TestEncodePEM(t *testing.T) {
+	der, err := NewCRLFromFile(Request{}, testCaFile, testCaKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(EncodePEM(der))
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatal("failed to PEM-encode CRL")
+	}
+}
@@ -3,13 +3,20 @@ package csr
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
+	"net"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 
 	cferr "github.com/cloudflare/cfssl/errors"
@@ -24,15 +31,57 @@ const (
 
 // A Name contains the SubjectInfo fields.
 type Name struct {
-	C  string // Country
-	ST string // State
-	L  string // Locality
-	O  string // OrganisationName
-	OU string // OrganisationalUnitName
+	C            string            // Country
+	ST           string            // State
+	L            string            // Locality
+	O            string            // OrganisationName
+	OU           string            // OrganisationalUnitName
+	SerialNumber string            // SerialNumber
+	Street       string            // StreetAddress
+	PostalCode   string            // PostalCode
+	E            string            // EmailAddress
+	DC           string            // DomainComponent
+	OIDs         map[string]string `json:"oids,omitempty"` // other attributes, keyed by dotted OID
+}
+
+var (
+	oidEmailAddress    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+	oidDomainComponent = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}
+)
+
+// parseOID parses a dotted OID such as "1.2.840.113549".
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, errors.New("invalid OID " + s)
+	}
+
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid OID " + s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+// ia5Attribute returns an attribute whose value is encoded as an
+// IA5String, as RFC 5280 requires for email addresses and domain
+// components.
+func ia5Attribute(oid asn1.ObjectIdentifier, value string) pkix.AttributeTypeAndValue {
+	return pkix.AttributeTypeAndValue{
+		Type:  oid,
+		Value: asn1.RawValue{Tag: asn1.TagIA5String, Bytes: []byte(value)},
+	}
 }
 
 // A KeyRequest contains the algorithm and key size for a new private
-// key.
+// key. The algorithm is one of "rsa", "rsa-pss", "ecdsa" or
+// "ed25519". An "rsa-pss" request generates an ordinary RSA key that
+// signs with RSASSA-PSS; the size of an Ed25519 key is fixed and may
+// be left out.
 type KeyRequest struct {
 	Algo string `json:"algo"`
 	Size int    `json:"size"`
@@ -46,11 +95,11 @@ var DefaultKeyRequest = KeyRequest{
 }
 
 // Generate generates a key as specified in the request. Currently,
-// only ECDSA and RSA are supported.
+// RSA, ECDSA and Ed25519 are supported.
 func (kr *KeyRequest) Generate() (interface{}, error) {
 	log.Debugf("generate key from request: algo=%s, size=%d", kr.Algo, kr.Size)
 	switch kr.Algo {
-	case "rsa":
+	case "rsa", "rsa-pss":
 		if kr.Size < 2048 {
 			return nil, errors.New("RSA key is too weak")
 		}
@@ -68,6 +117,12 @@ func (kr *KeyRequest) Generate() (interface{}, error) {
 			return nil, errors.New("invalid curve")
 		}
 		return ecdsa.GenerateKey(curve, rand.Reader)
+	case "ed25519":
+		if kr.Size != 0 && kr.Size != ed25519.PublicKeySize*8 {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
 	default:
 		return nil, errors.New("invalid algorithm")
 	}
@@ -88,6 +143,15 @@ func (kr *KeyRequest) SigAlgo() x509.SignatureAlgorithm {
 		default:
 			return x509.SHA1WithRSA
 		}
+	case "rsa-pss":
+		switch {
+		case kr.Size >= 4096:
+			return x509.SHA512WithRSAPSS
+		case kr.Size >= 3072:
+			return x509.SHA384WithRSAPSS
+		default:
+			return x509.SHA256WithRSAPSS
+		}
 	case "ecdsa":
 		switch {
 		case kr.Size == curveP521:
@@ -99,6 +163,8 @@ func (kr *KeyRequest) SigAlgo() x509.SignatureAlgorithm {
 		default:
 			return x509.ECDSAWithSHA1
 		}
+	case "ed25519":
+		return x509.PureEd25519
 	default:
 		return x509.UnknownSignatureAlgorithm
 	}
@@ -120,6 +186,48 @@ type CertificateRequest struct {
 	CA         *CAConfig   `json:"ca,omitempty"`
 }
 
+// SANs holds the subject alternative names of a certificate, by type.
+type SANs struct {
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []*url.URL
+}
+
+// ParseHosts sorts a list of hosts into subject alternative names. A
+// host is an IP address if it parses as one; a URI if it has a scheme,
+// such as "spiffe://example.com/workload" or "urn:uuid:..."; an email
+// address if it is a bare address such as "user@example.com"; and a
+// DNS name otherwise.
+func ParseHosts(hosts []string) SANs {
+	var sans SANs
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			sans.IPAddresses = append(sans.IPAddresses, ip)
+		} else if u := parseURIHost(host); u != nil {
+			sans.URIs = append(sans.URIs, u)
+		} else if addr, err := mail.ParseAddress(host); err == nil && addr.Address == host {
+			sans.EmailAddresses = append(sans.EmailAddresses, host)
+		} else {
+			sans.DNSNames = append(sans.DNSNames, host)
+		}
+	}
+	return sans
+}
+
+// parseURIHost returns host as a URI if it has a scheme, and nil
+// otherwise.
+func parseURIHost(host string) *url.URL {
+	if !strings.Contains(host, ":") {
+		return nil
+	}
+	u, err := url.Parse(host)
+	if err != nil || u.Scheme == "" {
+		return nil
+	}
+	return u
+}
+
 // appendIf appends to a if s is not an empty string.
 func appendIf(s string, a *[]string) {
 	if s != "" {
@@ -138,10 +246,49 @@ func (cr *CertificateRequest) Name() pkix.Name {
 		appendIf(n.L, &name.Locality)
 		appendIf(n.O, &name.Organization)
 		appendIf(n.OU, &name.OrganizationalUnit)
+		appendIf(n.Street, &name.StreetAddress)
+		appendIf(n.PostalCode, &name.PostalCode)
+		if n.SerialNumber != "" {
+			name.SerialNumber = n.SerialNumber
+		}
+		if n.E != "" {
+			name.ExtraNames = append(name.ExtraNames, ia5Attribute(oidEmailAddress, n.E))
+		}
+		if n.DC != "" {
+			name.ExtraNames = append(name.ExtraNames, ia5Attribute(oidDomainComponent, n.DC))
+		}
+
+		// Map iteration order is random, so the attributes are
+		// added in order of their OIDs. Invalid OIDs are caught by
+		// ValidNames.
+		oids := make([]string, 0, len(n.OIDs))
+		for oid := range n.OIDs {
+			oids = append(oids, oid)
+		}
+		sort.Strings(oids)
+		for _, s := range oids {
+			if oid, err := parseOID(s); err == nil {
+				name.ExtraNames = append(name.ExtraNames,
+					pkix.AttributeTypeAndValue{Type: oid, Value: n.OIDs[s]})
+			}
+		}
 	}
 	return name
 }
 
+// ValidNames checks that the OIDs of the extra attributes in the
+// request's names are well formed.
+func (cr *CertificateRequest) ValidNames() error {
+	for _, n := range cr.Names {
+		for s := range n.OIDs {
+			if _, err := parseOID(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // ParseRequest takes a certificate request and generates a key and
 // CSR from it. It does no validation -- caveat emptor. It will,
 // however, fail if the key request is not valid (i.e., an unsupported
@@ -150,6 +297,11 @@ func (cr *CertificateRequest) Name() pkix.Name {
 // request appropriately before calling this function.
 func ParseRequest(req *CertificateRequest) (csr, key []byte, err error) {
 	log.Info("received CSR")
+	if err = req.ValidNames(); err != nil {
+		err = cferr.Wrap(cferr.CSRError, cferr.BadRequest, err)
+		return
+	}
+
 	if req.KeyRequest == nil {
 		req.KeyRequest = &KeyRequest{
 			Algo: DefaultKeyRequest.Algo,
@@ -183,14 +335,29 @@ func ParseRequest(req *CertificateRequest) (csr, key []byte, err error) {
 			Bytes: key,
 		}
 		key = pem.EncodeToMemory(&block)
+	case ed25519.PrivateKey:
+		key, err = x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			err = cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+			return
+		}
+		block := pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: key,
+		}
+		key = pem.EncodeToMemory(&block)
 	default:
 		panic("Generate should have failed to produce a valid key.")
 	}
 
+	sans := ParseHosts(req.Hosts)
 	var tpl = x509.CertificateRequest{
 		Subject:            req.Name(),
 		SignatureAlgorithm: req.KeyRequest.SigAlgo(),
-		DNSNames:           req.Hosts,
+		DNSNames:           sans.DNSNames,
+		IPAddresses:        sans.IPAddresses,
+		EmailAddresses:     sans.EmailAddresses,
+		URIs:               sans.URIs,
 	}
 	csr, err = x509.CreateCertificateRequest(rand.Reader, &tpl, priv)
 	if err != nil {
@@ -235,7 +402,9 @@ func (g *Generator) ProcessRequest(req *CertificateRequest) (csr, key []byte, er
 func IsNameEmpty(n Name) bool {
 	empty := func(s string) bool { return strings.TrimSpace(s) == "" }
 
-	if empty(n.C) && empty(n.ST) && empty(n.L) && empty(n.O) && empty(n.OU) {
+	if empty(n.C) && empty(n.ST) && empty(n.L) && empty(n.O) && empty(n.OU) &&
+		empty(n.SerialNumber) && empty(n.Street) && empty(n.PostalCode) &&
+		empty(n.E) && empty(n.DC) && len(n.OIDs) == 0 {
 		return true
 	}
 	return false
@@ -2,9 +2,12 @@ package csr
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
 	"encoding/pem"
 	"testing"
 
@@ -409,3 +412,217 @@ func TestIsNameEmpty(t *testing.T) {
 		}
 	}
 }
+
+func TestParseHosts(t *testing.T) {
+	sans := ParseHosts([]string{
+		"cloudflare.com",
+		"127.0.0.1",
+		"::1",
+		"security@cloudflare.com",
+		"spiffe://cloudflare.com/ns/prod/sa/web",
+		"urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+	})
+
+	if len(sans.DNSNames) != 1 || sans.DNSNames[0] != "cloudflare.com" {
+		t.Fatalf("bad DNS names: %v", sans.DNSNames)
+	}
+	if len(sans.IPAddresses) != 2 {
+		t.Fatalf("bad IP addresses: %v", sans.IPAddresses)
+	}
+	if len(sans.EmailAddresses) != 1 || sans.EmailAddresses[0] != "security@cloudflare.com" {
+		t.Fatalf("bad email addresses: %v", sans.EmailAddresses)
+	}
+	if len(sans.URIs) != 2 || sans.URIs[0].Scheme != "spiffe" || sans.URIs[1].Scheme != "urn" {
+		t.Fatalf("bad URIs: %v", sans.URIs)
+	}
+}
+
+func TestParseRequestSANs(t *testing.T) {
+	var cr = &CertificateRequest{
+		CN:         "Test Common Name",
+		Hosts:      []string{"cloudflare.com", "10.0.0.1", "security@cloudflare.com", "spiffe://cloudflare.com/web"},
+		KeyRequest: &KeyRequest{"ecdsa", 256},
+	}
+
+	csrPEM, _, err := ParseRequest(cr)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(csr.DNSNames) != 1 || len(csr.IPAddresses) != 1 || len(csr.EmailAddresses) != 1 || len(csr.URIs) != 1 {
+		t.Fatalf("SANs not classified: %v %v %v %v", csr.DNSNames, csr.IPAddresses, csr.EmailAddresses, csr.URIs)
+	}
+}
+
+func TestExtendedName(t *testing.T) {
+	var cr = &CertificateRequest{
+		CN: "Test Common Name",
+		Names: []Name{
+			{
+				C:            "US",
+				SerialNumber: "1234",
+				Street:       "101 Townsend St",
+				PostalCode:   "94107",
+				E:            "admin@cloudflare.com",
+				DC:           "cloudflare",
+				OIDs:         map[string]string{"2.5.4.12": "Engineer", "1.3.6.1.4.1.99999.1": "custom"},
+			},
+			{DC: "com"},
+		},
+		KeyRequest: &KeyRequest{"ecdsa", 256},
+	}
+
+	name := cr.Name()
+	if name.SerialNumber != "1234" || len(name.StreetAddress) != 1 || len(name.PostalCode) != 1 {
+		t.Fatalf("extended attributes missing: %+v", name)
+	}
+	if len(name.ExtraNames) != 5 {
+		t.Fatalf("expected 5 extra attributes, got %v", name.ExtraNames)
+	}
+
+	csrPEM, _, err := ParseRequest(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string][]interface{}{}
+	for _, atv := range csr.Subject.Names {
+		values[atv.Type.String()] = append(values[atv.Type.String()], atv.Value)
+	}
+	if v := values["1.2.840.113549.1.9.1"]; len(v) != 1 || v[0] != "admin@cloudflare.com" {
+		t.Fatalf("bad email address: %v", v)
+	}
+	if v := values["0.9.2342.19200300.100.1.25"]; len(v) != 2 || v[0] != "cloudflare" || v[1] != "com" {
+		t.Fatalf("bad domain components: %v", v)
+	}
+	if v := values["1.3.6.1.4.1.99999.1"]; len(v) != 1 || v[0] != "custom" {
+		t.Fatalf("bad custom attribute: %v", v)
+	}
+	if csr.Subject.SerialNumber != "1234" || csr.Subject.PostalCode[0] != "94107" {
+		t.Fatalf("bad subject: %+v", csr.Subject)
+	}
+
+	// Email addresses and domain components are IA5Strings.
+	type rawAttribute struct {
+		Type  asn1.ObjectIdentifier
+		Value asn1.RawValue
+	}
+	var rdns []asn1.RawValue
+	if _, err = asn1.Unmarshal(csr.RawSubject, &rdns); err != nil {
+		t.Fatal(err)
+	}
+	var ia5 int
+	for _, rdn := range rdns {
+		var attributes []rawAttribute
+		if _, err = asn1.UnmarshalWithParams(rdn.FullBytes, &attributes, "set"); err != nil {
+			t.Fatal(err)
+		}
+		for _, atv := range attributes {
+			if atv.Type.Equal(oidEmailAddress) || atv.Type.Equal(oidDomainComponent) {
+				if atv.Value.Tag != asn1.TagIA5String {
+					t.Fatalf("%s is not an IA5String", atv.Type)
+				}
+				ia5++
+			}
+		}
+	}
+	if ia5 != 3 {
+		t.Fatalf("expected 3 IA5String attributes, got %d", ia5)
+	}
+
+	cr.Names[0].OIDs = map[string]string{"not.an.oid": "x"}
+	if _, _, err = ParseRequest(cr); err == nil {
+		t.Fatal("invalid OID should be rejected")
+	}
+}
+
+func TestExtendedNameJSON(t *testing.T) {
+	var cr CertificateRequest
+	err := json.Unmarshal([]byte(`{
+		"CN": "example.com",
+		"names": [{"C": "US", "O": "Example", "E": "admin@example.com", "oids": {"2.5.4.12": "Engineer"}}]
+	}`), &cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr.Names[0].O != "Example" || cr.Names[0].E != "admin@example.com" || cr.Names[0].OIDs["2.5.4.12"] != "Engineer" {
+		t.Fatalf("names not decoded: %+v", cr.Names)
+	}
+	if IsNameEmpty(Name{E: "admin@example.com"}) {
+		t.Fatal("a name with only an email address is not empty")
+	}
+}
+
+func TestEd25519AndPSSKeyGeneration(t *testing.T) {
+	kr := &KeyRequest{Algo: "ed25519"}
+	priv, err := kr.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := priv.(ed25519.PrivateKey); !ok {
+		t.Fatal("Generated key is not an Ed25519 key.")
+	}
+	if kr.SigAlgo() != x509.PureEd25519 {
+		t.Fatal("Invalid signature algorithm!")
+	}
+
+	kr = &KeyRequest{Algo: "ed25519", Size: 448}
+	if _, err = kr.Generate(); err == nil {
+		t.Fatal("Ed25519 key with an invalid size should not be generated.")
+	}
+
+	kr = &KeyRequest{Algo: "rsa-pss", Size: 2048}
+	if priv, err = kr.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := priv.(*rsa.PrivateKey); !ok {
+		t.Fatal("Generated key is not an RSA key.")
+	}
+	if kr.SigAlgo() != x509.SHA256WithRSAPSS {
+		t.Fatal("Invalid signature algorithm!")
+	}
+}
+
+func TestEd25519CertRequest(t *testing.T) {
+	var req = &CertificateRequest{
+		CN:         "Test Common Name",
+		Hosts:      []string{"cloudflare.com"},
+		KeyRequest: &KeyRequest{Algo: "ed25519"},
+	}
+
+	csrPEM, keyPEM, err := ParseRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		t.Fatal("Ed25519 key should be PEM-encoded PKCS #8.")
+	}
+	if _, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ = pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.SignatureAlgorithm != x509.PureEd25519 {
+		t.Fatalf("CSR signature algorithm is %v", csr.SignatureAlgorithm)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+}
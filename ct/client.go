@@ -0,0 +1,120 @@
+package ct
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// AddPreChainPath is the path, relative to a log's URL, to which
+// precertificates are submitted.
+const AddPreChainPath = "/ct/v1/add-pre-chain"
+
+// AddChainRequest is the body of an add-pre-chain request: the
+// precertificate followed by the chain that issued it, DER-encoded.
+type AddChainRequest struct {
+	Chain [][]byte `json:"chain"`
+}
+
+// AddChainResponse is a log's reply to an add-pre-chain request.
+type AddChainResponse struct {
+	SCTVersion uint8  `json:"sct_version"`
+	ID         []byte `json:"id"`
+	Timestamp  uint64 `json:"timestamp"`
+	Extensions []byte `json:"extensions"`
+	Signature  []byte `json:"signature"`
+}
+
+// MaxResponseSize is the largest reply to an add-pre-chain request
+// that a Client will read.
+const MaxResponseSize = 64 << 10
+
+// A Client submits precertificates to the log at URL, whose key is
+// PublicKey. A nil Fetcher means helpers.DefaultFetcher.
+type Client struct {
+	URL       string
+	PublicKey crypto.PublicKey
+	Fetcher   helpers.Fetcher
+}
+
+// AddPreChain submits a precertificate and its issuing chain, all
+// DER-encoded, to the log and returns the SCT it issues, once the SCT
+// has been checked against the log's key.
+func (c *Client) AddPreChain(ctx context.Context, chain [][]byte) (*SignedCertificateTimestamp, error) {
+	if c.PublicKey == nil {
+		return nil, errors.New("ct: no public key for " + c.URL)
+	}
+	if len(chain) < 2 {
+		return nil, errors.New("ct: a precertificate chain needs the precertificate and its issuer")
+	}
+	precert, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := x509.ParseCertificate(chain[1])
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(AddChainRequest{Chain: chain})
+	if err != nil {
+		return nil, err
+	}
+
+	f := c.Fetcher
+	if f == nil {
+		f = helpers.DefaultFetcher
+	}
+
+	resp, err := f.Post(ctx, strings.TrimSuffix(c.URL, "/")+AddPreChainPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp, MaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(respBody) > MaxResponseSize {
+		return nil, errors.New("ct: response from " + c.URL + " exceeds the maximum size")
+	}
+
+	var reply AddChainResponse
+	if err = json.Unmarshal(respBody, &reply); err != nil {
+		return nil, fmt.Errorf("ct: bad response from %s: %v", c.URL, err)
+	}
+
+	sct := &SignedCertificateTimestamp{
+		Version:    reply.SCTVersion,
+		Timestamp:  reply.Timestamp,
+		Extensions: reply.Extensions,
+	}
+	if sct.Version != 0 {
+		return nil, errors.New("ct: unsupported SCT version from " + c.URL)
+	}
+	if len(reply.ID) != len(sct.LogID) {
+		return nil, errors.New("ct: bad log ID from " + c.URL)
+	}
+	copy(sct.LogID[:], reply.ID)
+
+	ds, err := ParseDigitallySigned(reply.Signature)
+	if err != nil {
+		return nil, err
+	}
+	sct.Signature = *ds
+
+	if err = VerifySCT(c.PublicKey, sct, precert, issuer); err != nil {
+		return nil, fmt.Errorf("ct: bad SCT from %s: %v", c.URL, err)
+	}
+	return sct, nil
+}
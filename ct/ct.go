@@ -0,0 +1,368 @@
+// Package ct implements the parts of Certificate Transparency (RFC
+// 6962) that a CA needs to embed signed certificate timestamps (SCTs)
+// in the certificates it issues: precertificates, the encoding of SCTs
+// and the SCT list extension, and verification of SCT signatures.
+package ct
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+var (
+	// PoisonOID identifies the critical extension that marks a
+	// precertificate, so that it can't be used as a certificate.
+	PoisonOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+
+	// SCTListOID identifies the extension that holds the SCTs
+	// embedded in a certificate.
+	SCTListOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+)
+
+// PoisonExtension returns the extension that turns a certificate into
+// a precertificate.
+func PoisonExtension() pkix.Extension {
+	return pkix.Extension{Id: PoisonOID, Critical: true, Value: asn1.NullBytes}
+}
+
+// Hash and signature algorithm identifiers from TLS 1.2 (RFC 5246),
+// as used in the digitally-signed SCT signature.
+const (
+	HashSHA256     = 4
+	SignatureRSA   = 1
+	SignatureECDSA = 3
+)
+
+// A DigitallySigned is a TLS digitally-signed struct: a signature
+// together with the algorithms that made it.
+type DigitallySigned struct {
+	HashAlgorithm      uint8
+	SignatureAlgorithm uint8
+	Signature          []byte
+}
+
+// Serialize returns the TLS encoding of the signature.
+func (ds *DigitallySigned) Serialize() ([]byte, error) {
+	if len(ds.Signature) > 0xffff {
+		return nil, errors.New("ct: signature too long")
+	}
+	b := []byte{ds.HashAlgorithm, ds.SignatureAlgorithm, 0, 0}
+	binary.BigEndian.PutUint16(b[2:], uint16(len(ds.Signature)))
+	return append(b, ds.Signature...), nil
+}
+
+// ParseDigitallySigned parses the TLS encoding of a signature.
+func ParseDigitallySigned(b []byte) (*DigitallySigned, error) {
+	ds, rest, err := parseDigitallySigned(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("ct: trailing data after signature")
+	}
+	return ds, nil
+}
+
+func parseDigitallySigned(b []byte) (*DigitallySigned, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, errors.New("ct: truncated signature")
+	}
+	ds := &DigitallySigned{HashAlgorithm: b[0], SignatureAlgorithm: b[1]}
+	sig, rest, err := readOpaque16(b[2:])
+	if err != nil {
+		return nil, nil, err
+	}
+	ds.Signature = sig
+	return ds, rest, nil
+}
+
+// A SignedCertificateTimestamp is a log's promise to include a
+// certificate, as defined in RFC 6962 section 3.2.
+type SignedCertificateTimestamp struct {
+	Version    uint8
+	LogID      [sha256.Size]byte
+	Timestamp  uint64
+	Extensions []byte
+	Signature  DigitallySigned
+}
+
+// Serialize returns the TLS encoding of the SCT.
+func (sct *SignedCertificateTimestamp) Serialize() ([]byte, error) {
+	if len(sct.Extensions) > 0xffff {
+		return nil, errors.New("ct: SCT extensions too long")
+	}
+	sig, err := sct.Signature.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 0, 1+len(sct.LogID)+8+2+len(sct.Extensions)+len(sig))
+	b = append(b, sct.Version)
+	b = append(b, sct.LogID[:]...)
+	b = appendUint64(b, sct.Timestamp)
+	b = appendUint16(b, uint16(len(sct.Extensions)))
+	b = append(b, sct.Extensions...)
+	return append(b, sig...), nil
+}
+
+// ParseSCT parses the TLS encoding of an SCT.
+func ParseSCT(b []byte) (*SignedCertificateTimestamp, error) {
+	sct := new(SignedCertificateTimestamp)
+	if len(b) < 1+len(sct.LogID)+8 {
+		return nil, errors.New("ct: truncated SCT")
+	}
+	sct.Version = b[0]
+	if sct.Version != 0 {
+		return nil, errors.New("ct: unsupported SCT version")
+	}
+	b = b[1:]
+	copy(sct.LogID[:], b)
+	b = b[len(sct.LogID):]
+	sct.Timestamp = binary.BigEndian.Uint64(b)
+
+	var err error
+	if sct.Extensions, b, err = readOpaque16(b[8:]); err != nil {
+		return nil, err
+	}
+	ds, rest, err := parseDigitallySigned(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("ct: trailing data after SCT")
+	}
+	sct.Signature = *ds
+	return sct, nil
+}
+
+// SCTListExtension returns the extension that embeds scts in a
+// certificate.
+func SCTListExtension(scts []*SignedCertificateTimestamp) (pkix.Extension, error) {
+	var list []byte
+	for _, sct := range scts {
+		b, err := sct.Serialize()
+		if err != nil {
+			return pkix.Extension{}, err
+		}
+		list = appendUint16(list, uint16(len(b)))
+		list = append(list, b...)
+	}
+	if len(list) == 0 || len(list) > 0xffff {
+		return pkix.Extension{}, errors.New("ct: SCT list must hold between 1 and 65535 bytes")
+	}
+
+	value, err := asn1.Marshal(append(appendUint16(nil, uint16(len(list))), list...))
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: SCTListOID, Value: value}, nil
+}
+
+// ParseSCTList parses the value of an SCT list extension.
+func ParseSCTList(value []byte) ([]*SignedCertificateTimestamp, error) {
+	var list []byte
+	if rest, err := asn1.Unmarshal(value, &list); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("ct: trailing data after SCT list")
+	}
+
+	list, rest, err := readOpaque16(list)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("ct: trailing data after SCT list")
+	}
+
+	var scts []*SignedCertificateTimestamp
+	for len(list) > 0 {
+		var b []byte
+		if b, list, err = readOpaque16(list); err != nil {
+			return nil, err
+		}
+		sct, err := ParseSCT(b)
+		if err != nil {
+			return nil, err
+		}
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+// tbsCertificate mirrors the TBSCertificate structure of RFC 5280
+// closely enough to edit its extensions.
+type tbsCertificate struct {
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           asn1.RawValue
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	UniqueID           asn1.BitString   `asn1:"optional,tag:1"`
+	SubjectUniqueID    asn1.BitString   `asn1:"optional,tag:2"`
+	Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+// RemoveExtension returns the DER-encoded TBSCertificate tbs without
+// the extension identified by oid. A precertificate's TBSCertificate
+// without the poison extension, and a certificate's without the SCT
+// list extension, are what log signatures cover.
+func RemoveExtension(tbs []byte, oid asn1.ObjectIdentifier) ([]byte, error) {
+	var cert tbsCertificate
+	if rest, err := asn1.Unmarshal(tbs, &cert); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("ct: trailing data after TBSCertificate")
+	}
+
+	var exts []pkix.Extension
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oid) {
+			exts = append(exts, ext)
+		}
+	}
+	cert.Extensions = exts
+	return asn1.Marshal(cert)
+}
+
+// PrecertSignedData returns the data a log signs in an SCT for a
+// precertificate issued by the CA whose public key hashes to
+// issuerKeyHash. tbs is the precertificate's TBSCertificate without
+// the poison extension.
+func PrecertSignedData(sct *SignedCertificateTimestamp, issuerKeyHash [sha256.Size]byte, tbs []byte) ([]byte, error) {
+	if len(tbs) > 0xffffff {
+		return nil, errors.New("ct: TBSCertificate too long")
+	}
+	if len(sct.Extensions) > 0xffff {
+		return nil, errors.New("ct: SCT extensions too long")
+	}
+
+	// Version, signature type certificate_timestamp (0), timestamp
+	// and log entry type precert_entry (1).
+	b := []byte{sct.Version, 0}
+	b = appendUint64(b, sct.Timestamp)
+	b = appendUint16(b, 1)
+	b = append(b, issuerKeyHash[:]...)
+	b = append(b, byte(len(tbs)>>16), byte(len(tbs)>>8), byte(len(tbs)))
+	b = append(b, tbs...)
+	b = appendUint16(b, uint16(len(sct.Extensions)))
+	return append(b, sct.Extensions...), nil
+}
+
+// IssuerKeyHash returns the hash of the issuer's public key that
+// identifies it in precertificate log entries.
+func IssuerKeyHash(issuer *x509.Certificate) [sha256.Size]byte {
+	return sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+}
+
+// LogID returns the ID of the log with the given public key.
+func LogID(pub crypto.PublicKey) ([sha256.Size]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(der), nil
+}
+
+// Sign makes the signature over data that a log with the given key
+// puts in an SCT.
+func Sign(priv crypto.Signer, data []byte) (*DigitallySigned, error) {
+	ds := &DigitallySigned{HashAlgorithm: HashSHA256}
+	switch priv.Public().(type) {
+	case *ecdsa.PublicKey:
+		ds.SignatureAlgorithm = SignatureECDSA
+	case *rsa.PublicKey:
+		ds.SignatureAlgorithm = SignatureRSA
+	default:
+		return nil, errors.New("ct: unsupported log key")
+	}
+
+	digest := sha256.Sum256(data)
+	sig, err := priv.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	ds.Signature = sig
+	return ds, nil
+}
+
+// VerifySCT checks that sct is a valid signature, by the log with the
+// given public key, over cert as issued by issuer. cert may be the
+// precertificate or the final certificate with the SCTs embedded.
+func VerifySCT(pub crypto.PublicKey, sct *SignedCertificateTimestamp, cert, issuer *x509.Certificate) error {
+	logID, err := LogID(pub)
+	if err != nil {
+		return err
+	}
+	if logID != sct.LogID {
+		return errors.New("ct: SCT is from a different log")
+	}
+
+	tbs, err := RemoveExtension(cert.RawTBSCertificate, PoisonOID)
+	if err != nil {
+		return err
+	}
+	if tbs, err = RemoveExtension(tbs, SCTListOID); err != nil {
+		return err
+	}
+
+	data, err := PrecertSignedData(sct, IssuerKeyHash(issuer), tbs)
+	if err != nil {
+		return err
+	}
+
+	if sct.Signature.HashAlgorithm != HashSHA256 {
+		return errors.New("ct: unsupported SCT hash algorithm")
+	}
+	digest := sha256.Sum256(data)
+
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		if sct.Signature.SignatureAlgorithm != SignatureECDSA {
+			return errors.New("ct: SCT signature algorithm does not match the log key")
+		}
+		if !ecdsa.VerifyASN1(pub, digest[:], sct.Signature.Signature) {
+			return errors.New("ct: SCT signature verification failure")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if sct.Signature.SignatureAlgorithm != SignatureRSA {
+			return errors.New("ct: SCT signature algorithm does not match the log key")
+		}
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sct.Signature.Signature)
+	default:
+		return errors.New("ct: unsupported log key")
+	}
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// readOpaque16 reads a TLS opaque value with a two-byte length.
+func readOpaque16(b []byte) (value, rest []byte, err error) {
+	if len(b) < 2 {
+		return nil, nil, errors.New("ct: truncated length")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, errors.New("ct: truncated value")
+	}
+	return b[2 : 2+n], b[2+n:], nil
+}
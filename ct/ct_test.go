@@ -0,0 +1,194 @@
+package ct
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testSCT() *SignedCertificateTimestamp {
+	sct := &SignedCertificateTimestamp{
+		Timestamp:  1500000000000,
+		Extensions: []byte{1, 2, 3},
+		Signature: DigitallySigned{
+			HashAlgorithm:      HashSHA256,
+			SignatureAlgorithm: SignatureECDSA,
+			Signature:          []byte("signature"),
+		},
+	}
+	sct.LogID[0] = 0xaa
+	return sct
+}
+
+func TestSCTListRoundTrip(t *testing.T) {
+	scts := []*SignedCertificateTimestamp{testSCT(), testSCT()}
+	scts[1].Timestamp++
+
+	ext, err := SCTListExtension(scts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ext.Id.Equal(SCTListOID) || ext.Critical {
+		t.Fatalf("unexpected extension %v", ext)
+	}
+
+	parsed, err := ParseSCTList(ext.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(scts) {
+		t.Fatalf("expected %d SCTs, got %d", len(scts), len(parsed))
+	}
+	for i := range scts {
+		want, _ := scts[i].Serialize()
+		got, _ := parsed[i].Serialize()
+		if !bytes.Equal(want, got) {
+			t.Fatalf("SCT %d changed in the round trip", i)
+		}
+	}
+
+	if _, err = SCTListExtension(nil); err == nil {
+		t.Fatal("an empty SCT list was accepted")
+	}
+
+	b, _ := testSCT().Serialize()
+	if _, err = ParseSCT(b[:len(b)-1]); err == nil {
+		t.Fatal("a truncated SCT was accepted")
+	}
+	if _, err = ParseSCT(append(b, 0)); err == nil {
+		t.Fatal("an SCT with trailing data was accepted")
+	}
+}
+
+func TestPrecertSCT(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CT test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		Subject:         pkix.Name{CommonName: "example.com"},
+		DNSNames:        []string{"example.com"},
+		NotBefore:       time.Now(),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{PoisonExtension()},
+	}
+	precertDER, err := x509.CreateCertificate(rand.Reader, template, ca, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	precert, err := x509.ParseCertificate(precertDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A stand-in log that signs what it's given.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != AddPreChainPath {
+			http.NotFound(w, r)
+			return
+		}
+		id, _ := LogID(logKey.Public())
+		sct := &SignedCertificateTimestamp{LogID: id, Timestamp: 1}
+		tbs, err := RemoveExtension(precert.RawTBSCertificate, PoisonOID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := PrecertSignedData(sct, IssuerKeyHash(ca), tbs)
+		sig, _ := Sign(logKey, data)
+		sigBytes, _ := sig.Serialize()
+		json.NewEncoder(w).Encode(AddChainResponse{ID: id[:], Timestamp: 1, Signature: sigBytes})
+	}))
+	defer srv.Close()
+
+	client := &Client{URL: srv.URL + "/", PublicKey: logKey.Public()}
+	sct, err := client.AddPreChain(context.Background(), [][]byte{precertDER, caDER})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An SCT is only returned if it verifies under the client's key.
+	if _, err = (&Client{URL: srv.URL}).AddPreChain(context.Background(), [][]byte{precertDER, caDER}); err == nil {
+		t.Fatal("expected an error from a client with no log key")
+	}
+	client.PublicKey = caKey.Public()
+	if _, err = client.AddPreChain(context.Background(), [][]byte{precertDER, caDER}); err == nil {
+		t.Fatal("expected an error for an SCT from a different log")
+	}
+	if err = VerifySCT(logKey.Public(), sct, precert, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	// The SCT also verifies against the final certificate, which
+	// carries the SCT list instead of the poison.
+	ext, err := SCTListExtension([]*SignedCertificateTimestamp{sct})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.ExtraExtensions = []pkix.Extension{ext}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifySCT(logKey.Public(), sct, cert, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	// A different certificate, or a different log, doesn't verify.
+	template.SerialNumber = big.NewInt(3)
+	otherDER, _ := x509.CreateCertificate(rand.Reader, template, ca, caKey.Public(), caKey)
+	other, _ := x509.ParseCertificate(otherDER)
+	if err = VerifySCT(logKey.Public(), sct, other, ca); err == nil {
+		t.Fatal("SCT verified for the wrong certificate")
+	}
+	if err = VerifySCT(caKey.Public(), sct, cert, ca); err == nil {
+		t.Fatal("SCT verified for the wrong log")
+	}
+
+	// Removing an extension that isn't there leaves the encoding as
+	// it was.
+	tbs, err := RemoveExtension(other.RawTBSCertificate, PoisonOID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tbs, other.RawTBSCertificate) {
+		t.Fatal("RemoveExtension changed an unpoisoned TBSCertificate")
+	}
+}
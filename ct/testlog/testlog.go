@@ -0,0 +1,140 @@
+// Package testlog provides an in-process Certificate Transparency log
+// that issues SCTs for precertificates, for use in tests of packages
+// that submit to CT logs.
+package testlog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/ct"
+)
+
+// A Log is a CT log served over HTTP from httptest. It only accepts
+// precertificates, and signs SCTs without keeping a tree.
+type Log struct {
+	*httptest.Server
+	Key   *ecdsa.PrivateKey
+	LogID [32]byte
+
+	mu          sync.Mutex
+	submissions int
+}
+
+// New starts a new log with a fresh key. It panics if the key can't be
+// generated. The caller should Close the log when it is done.
+func New() *Log {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id, err := ct.LogID(key.Public())
+	if err != nil {
+		panic(err)
+	}
+
+	l := &Log{Key: key, LogID: id}
+	mux := http.NewServeMux()
+	mux.HandleFunc(ct.AddPreChainPath, l.addPreChain)
+	l.Server = httptest.NewServer(mux)
+	return l
+}
+
+// Submissions returns the number of precertificates the log has
+// accepted.
+func (l *Log) Submissions() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.submissions
+}
+
+func (l *Log) addPreChain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ct.AddChainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := l.sign(req.Chain)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l.mu.Lock()
+	l.submissions++
+	l.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (l *Log) sign(chain [][]byte) (*ct.AddChainResponse, error) {
+	if len(chain) < 2 {
+		return nil, errors.New("chain must hold a precertificate and its issuer")
+	}
+	precert, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := x509.ParseCertificate(chain[1])
+	if err != nil {
+		return nil, err
+	}
+	if err = precert.CheckSignatureFrom(issuer); err != nil {
+		return nil, err
+	}
+
+	poisoned := false
+	for _, ext := range precert.Extensions {
+		if ext.Id.Equal(ct.PoisonOID) && ext.Critical {
+			poisoned = true
+		}
+	}
+	if !poisoned {
+		return nil, errors.New("precertificate has no poison extension")
+	}
+
+	tbs, err := ct.RemoveExtension(precert.RawTBSCertificate, ct.PoisonOID)
+	if err != nil {
+		return nil, err
+	}
+
+	sct := &ct.SignedCertificateTimestamp{
+		LogID:     l.LogID,
+		Timestamp: uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+	}
+	data, err := ct.PrecertSignedData(sct, ct.IssuerKeyHash(issuer), tbs)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := ct.Sign(l.Key, data)
+	if err != nil {
+		return nil, err
+	}
+	sigBytes, err := sig.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ct.AddChainResponse{
+		SCTVersion: sct.Version,
+		ID:         sct.LogID[:],
+		Timestamp:  sct.Timestamp,
+		Extensions: sct.Extensions,
+		Signature:  sigBytes,
+	}, nil
+}
@@ -38,6 +38,10 @@ The index of codes are listed below:
 	    5200: InvalidPolicy
 	    5300: InvalidRequest
 	    6XXX: DialError
+	10XXX: CertStoreError
+	    10100: InsertionFailed
+	    10200: RecordNotFound
+	    10300: AlreadyRevoked
 
 2. Type HttpError is intended for CF SSL API to consume. It contains a HTTP status code that will be read and returned
 by the API server.
@@ -52,6 +52,12 @@ const (
 
 	// CSRError indicates a problem with CSR parsing
 	CSRError // 9XXX
+
+	// CertStoreError indicates a problem with the certificate store
+	CertStoreError // 10XXX
+
+	// CTError indicates a problem with Certificate Transparency
+	CTError // 11XXX
 )
 
 // None is a non-specified error.
@@ -90,6 +96,10 @@ const (
 
 	// SerialSeqParseError -- SerialSeq failed to parse as hex digits
 	SerialSeqParseError // Code 14XX
+
+	// DuplicateSerial indicates that no serial number could be found
+	// that is not already in use in the certificate store.
+	DuplicateSerial // Code 15XX
 )
 
 const (
@@ -105,9 +115,9 @@ const (
 	// these keys.
 	Encrypted Reason = 100 * (iota + 1) //21XX
 
-	// NotRSAOrECC indicates that they key is not an RSA or ECC
-	// private key; these are the only two private key types supported
-	// at this time by CFSSL.
+	// NotRSAOrECC indicates that they key is not an RSA, ECC or
+	// Ed25519 private key; these are the only private key types
+	// supported at this time by CFSSL.
 	NotRSAOrECC //22XX
 
 	// KeyMismatch indicates that the private key does not match
@@ -138,6 +148,15 @@ const (
 	// InvalidRequest indicates a certificate request violated the
 	// constraints of the policy being applied to the request.
 	InvalidRequest // 53XX
+
+	// UnauthorizedName indicates that a certificate request asked
+	// for a name that the profile's allowed names do not permit.
+	UnauthorizedName // 54XX
+
+	// UnauthorizedKey indicates that a certificate request's public
+	// key does not meet the profile's key algorithm or key size
+	// requirements.
+	UnauthorizedKey // 55XX
 )
 
 // The following are API client related errors, and should be
@@ -171,6 +190,34 @@ const (
 	// InvalidStatus occurs when the OCSP signing requests includes an
 	// invalid value for the certificate status.
 	InvalidStatus
+
+	// InvalidReason occurs when a revocation request includes an
+	// unknown revocation reason.
+	InvalidReason
+)
+
+// The following are certificate store related errors, and should be
+// specified with CertStoreError.
+const (
+	// InsertionFailed occurs when a record could not be written to
+	// the certificate store.
+	InsertionFailed Reason = 100 * (iota + 1) // 101XX
+
+	// RecordNotFound occurs when a record requested from the
+	// certificate store does not exist.
+	RecordNotFound // 102XX
+
+	// AlreadyRevoked occurs when a certificate to be revoked is
+	// already revoked in the certificate store.
+	AlreadyRevoked // 103XX
+)
+
+// The following are Certificate Transparency related errors, and
+// should be specified with CTError.
+const (
+	// PrecertSubmitFailed occurs when a precertificate could not be
+	// submitted to a CT log, or the log's response could not be used.
+	PrecertSubmitFailed Reason = 100 * (iota + 1) // 111XX
 )
 
 // The error interface implementation, which formats to a JSON object string.
@@ -198,6 +245,8 @@ func New(category Category, reason Reason) *Error {
 			msg = "Certificate not issued by this issuer"
 		case InvalidStatus:
 			msg = "Invalid revocation status"
+		case InvalidReason:
+			msg = "Invalid revocation reason"
 		}
 	case CertificateError:
 		switch reason {
@@ -215,6 +264,10 @@ func New(category Category, reason Reason) *Error {
 			msg = "Unable to verify certificate"
 		case BadRequest:
 			msg = "Invalid certificate request"
+		case SerialSeqParseError:
+			msg = "Failed to parse serial number sequence"
+		case DuplicateSerial:
+			msg = "Failed to generate a unique serial number"
 		default:
 			panic(fmt.Sprintf("Unsupported CF-SSL error reason %d under category CertificateError.",
 				reason))
@@ -282,6 +335,10 @@ func New(category Category, reason Reason) *Error {
 			msg = "Invalid or unknown policy"
 		case InvalidRequest:
 			msg = "Policy violation request"
+		case UnauthorizedName:
+			msg = "Policy violation: name not allowed by profile"
+		case UnauthorizedKey:
+			msg = "Policy violation: key not allowed by profile"
 		default:
 			panic(fmt.Sprintf("Unsupported CF-SSL error reason %d under category PolicyError.",
 				reason))
@@ -325,6 +382,28 @@ func New(category Category, reason Reason) *Error {
 		default:
 			panic(fmt.Sprintf("Unsupported CF-SSL error reason %d under category APIClientError.", reason))
 		}
+	case CertStoreError:
+		switch reason {
+		case Unknown:
+			msg = "Certificate store action failed due to unknown error"
+		case InsertionFailed:
+			msg = "Failed to insert record into certificate store"
+		case RecordNotFound:
+			msg = "Record not found in certificate store"
+		case AlreadyRevoked:
+			msg = "Certificate is already revoked"
+		default:
+			panic(fmt.Sprintf("Unsupported CF-SSL error reason %d under category CertStoreError.", reason))
+		}
+	case CTError:
+		switch reason {
+		case Unknown:
+			msg = "Certificate Transparency action failed due to unknown error"
+		case PrecertSubmitFailed:
+			msg = "Failed to submit precertificate to CT log"
+		default:
+			panic(fmt.Sprintf("Unsupported CF-SSL error reason %d under category CTError.", reason))
+		}
 
 	default:
 		panic(fmt.Sprintf("Unsupported CF-SSL error type: %d.",
@@ -360,7 +439,7 @@ func Wrap(category Category, reason Reason, err error) *Error {
 				errorCode += unknownAuthority
 			}
 		}
-	case PrivateKeyError, IntermediatesError, RootError, PolicyError, DialError, APIClientError, CSRError:
+	case PrivateKeyError, IntermediatesError, RootError, PolicyError, DialError, APIClientError, CSRError, CertStoreError, CTError:
 		// no-op, just use the error
 	default:
 		panic(fmt.Sprintf("Unsupported CF-SSL error type: %d.",
@@ -34,6 +34,11 @@ func TestNew(t *testing.T) {
 		t.Fatal("Improper error code")
 	}
 
+	code = New(OCSPError, InvalidReason).ErrorCode
+	if code != 8300 {
+		t.Fatal("Improper error code")
+	}
+
 	code = New(CertificateError, Unknown).ErrorCode
 	if code != 1000 {
 		t.Fatal("Improper error code")
@@ -62,6 +67,14 @@ func TestNew(t *testing.T) {
 	if code != 1300 {
 		t.Fatal("Improper error code")
 	}
+	code = New(CertificateError, SerialSeqParseError).ErrorCode
+	if code != 1400 {
+		t.Fatal("Improper error code")
+	}
+	code = New(CertificateError, DuplicateSerial).ErrorCode
+	if code != 1500 {
+		t.Fatal("Improper error code")
+	}
 
 	code = New(PrivateKeyError, Unknown).ErrorCode
 	if code != 2000 {
@@ -150,6 +163,14 @@ func TestNew(t *testing.T) {
 	if code != 5300 {
 		t.Fatal("Improper error code")
 	}
+	code = New(PolicyError, UnauthorizedName).ErrorCode
+	if code != 5400 {
+		t.Fatal("Improper error code")
+	}
+	code = New(PolicyError, UnauthorizedKey).ErrorCode
+	if code != 5500 {
+		t.Fatal("Improper error code")
+	}
 
 	code = New(DialError, Unknown).ErrorCode
 	if code != 6000 {
@@ -201,6 +222,33 @@ func TestNew(t *testing.T) {
 	if code != 9300 {
 		t.Fatal("Improper error code")
 	}
+
+	code = New(CertStoreError, Unknown).ErrorCode
+	if code != 10000 {
+		t.Fatal("Improper error code")
+	}
+	code = New(CertStoreError, InsertionFailed).ErrorCode
+	if code != 10100 {
+		t.Fatal("Improper error code")
+	}
+	code = New(CertStoreError, RecordNotFound).ErrorCode
+	if code != 10200 {
+		t.Fatal("Improper error code")
+	}
+
+	code = New(CertStoreError, AlreadyRevoked).ErrorCode
+	if code != 10300 {
+		t.Fatal("Improper error code")
+	}
+
+	code = New(CTError, Unknown).ErrorCode
+	if code != 11000 {
+		t.Fatal("Improper error code")
+	}
+	code = New(CTError, PrecertSubmitFailed).ErrorCode
+	if code != 11100 {
+		t.Fatal("Improper error code")
+	}
 }
 
 func TestWrap(t *testing.T) {
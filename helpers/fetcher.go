@@ -0,0 +1,84 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// A Fetcher retrieves remote resources such as CRLs, AIA issuer
+// certificates and OCSP responses. Implementations return an error
+// for responses other than 2xx, and the caller must close the body
+// that is returned. Fetchers make it possible to set timeouts and
+// egress proxies, and to stand in for the network in tests.
+type Fetcher interface {
+	Get(ctx context.Context, url string) (io.ReadCloser, error)
+	Post(ctx context.Context, url, contentType string, body io.Reader) (io.ReadCloser, error)
+}
+
+// HTTPFetcher is a Fetcher that uses an http.Client. A nil Client
+// means http.DefaultClient.
+type HTTPFetcher struct {
+	Client *http.Client
+}
+
+// DefaultFetchTimeout bounds each request made by DefaultFetcher, so
+// that an unresponsive OCSP responder, AIA or CRL server, or CT log
+// can't hang a caller that passes no deadline of its own.
+const DefaultFetchTimeout = 30 * time.Second
+
+// DefaultFetcher is the Fetcher used when none is configured. Its
+// requests time out after DefaultFetchTimeout.
+var DefaultFetcher Fetcher = NewHTTPFetcher(DefaultFetchTimeout, nil)
+
+// NewHTTPFetcher returns an HTTPFetcher whose requests time out after
+// timeout, if it is positive, and go through the given proxy, if it
+// is not nil. With a nil proxy, the proxy is taken from the
+// environment.
+func NewHTTPFetcher(timeout time.Duration, proxy *url.URL) *HTTPFetcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &HTTPFetcher{Client: &http.Client{Timeout: timeout, Transport: transport}}
+}
+
+// Get fetches url.
+func (f *HTTPFetcher) Get(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f.do(ctx, req)
+}
+
+// Post sends body to url with the given content type.
+func (f *HTTPFetcher) Post(ctx context.Context, url, contentType string, body io.Reader) (io.ReadCloser, error) {
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return f.do(ctx, req)
+}
+
+func (f *HTTPFetcher) do(ctx context.Context, req *http.Request) (io.ReadCloser, error) {
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: HTTP status %d", req.Method, req.URL, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
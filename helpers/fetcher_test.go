@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPFetcher(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/slow":
+			time.Sleep(time.Second)
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Write([]byte(r.Method + " " + r.Header.Get("Content-Type") + " " + string(body)))
+		}
+	}))
+	defer ts.Close()
+
+	f := NewHTTPFetcher(100*time.Millisecond, nil)
+
+	body, err := f.Post(context.Background(), ts.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := ioutil.ReadAll(body)
+	body.Close()
+	if string(out) != "POST text/plain hello" {
+		t.Fatalf("unexpected response %q", out)
+	}
+
+	if _, err = f.Get(context.Background(), ts.URL+"/missing"); err == nil {
+		t.Fatal("a 404 response should be an error")
+	}
+	if _, err = f.Get(context.Background(), ts.URL+"/slow"); err == nil {
+		t.Fatal("the request should have timed out")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = DefaultFetcher.Get(ctx, ts.URL); err == nil {
+		t.Fatal("a cancelled request should fail")
+	}
+	if hf := DefaultFetcher.(*HTTPFetcher); hf.Client == nil || hf.Client.Timeout != DefaultFetchTimeout {
+		t.Fatal("the default fetcher should time out")
+	}
+}
+
+func TestHTTPFetcherProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied " + r.URL.String()))
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewHTTPFetcher(time.Second, proxyURL)
+	body, err := f.Get(context.Background(), "http://crl.example.com/ca.crl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := ioutil.ReadAll(body)
+	body.Close()
+	if string(out) != "proxied http://crl.example.com/ca.crl" {
+		t.Fatalf("request did not go through the proxy: %q", out)
+	}
+}
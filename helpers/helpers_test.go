@@ -2,6 +2,7 @@ package helpers
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -23,6 +24,7 @@ const (
 	testEmptyCertFile       = "testdata/emptycert.pem"
 	testPrivateRSAKey       = "testdata/priv_rsa_key.pem"
 	testPrivateECDSAKey     = "testdata/private_ecdsa_key.pem"
+	testPrivateEd25519Key   = "testdata/priv_ed25519_key.pem"
 	testUnsupportedECDSAKey = "testdata/secp256k1-key.pem"
 	testMessedUpPrivateKey  = "testdata/messed_up_priv_key.pem"
 	testEncryptedPrivateKey = "testdata/enc_priv_key.pem"
@@ -64,6 +66,12 @@ func TestKeyLength(t *testing.T) {
 	if expRsa != outRsa {
 		t.Fatal("KeyLength malfunctioning on rsa input")
 	}
+
+	//test the ed25519 branch
+	ed25519In, _, _ := ed25519.GenerateKey(rand.Reader)
+	if KeyLength(ed25519In) != 256 {
+		t.Fatal("KeyLength malfunctioning on ed25519 input")
+	}
 }
 
 func TestExpiryTime(t *testing.T) {
@@ -129,6 +137,12 @@ func TestHashAlgoString(t *testing.T) {
 	if HashAlgoString(x509.ECDSAWithSHA512) != "SHA512" {
 		t.Fatal("standin")
 	}
+	if HashAlgoString(x509.SHA256WithRSAPSS) != "SHA256" {
+		t.Fatal("standin")
+	}
+	if HashAlgoString(x509.PureEd25519) != "SHA512" {
+		t.Fatal("standin")
+	}
 	if HashAlgoString(math.MaxInt32) != "Unknown Hash Algorithm" {
 		t.Fatal("standin")
 	}
@@ -171,6 +185,18 @@ func TestSignatureString(t *testing.T) {
 	if SignatureString(x509.ECDSAWithSHA512) != "ECDSAWithSHA512" {
 		t.Fatal("Signature String functioning improperly")
 	}
+	if SignatureString(x509.SHA256WithRSAPSS) != "SHA256WithRSAPSS" {
+		t.Fatal("Signature String functioning improperly")
+	}
+	if SignatureString(x509.SHA384WithRSAPSS) != "SHA384WithRSAPSS" {
+		t.Fatal("Signature String functioning improperly")
+	}
+	if SignatureString(x509.SHA512WithRSAPSS) != "SHA512WithRSAPSS" {
+		t.Fatal("Signature String functioning improperly")
+	}
+	if SignatureString(x509.PureEd25519) != "Ed25519" {
+		t.Fatal("Signature String functioning improperly")
+	}
 	if SignatureString(math.MaxInt32) != "Unknown Signature" {
 		t.Fatal("Signature String functioning improperly")
 	}
@@ -266,6 +292,15 @@ func TestParsePrivateKeyPEM(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	testEd25519PEM, _ := ioutil.ReadFile(testPrivateEd25519Key)
+	key, err := ParsePrivateKeyPEM(testEd25519PEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := key.(ed25519.PrivateKey); !ok {
+		t.Fatal("Ed25519 private key parsed as the wrong type")
+	}
+
 	// error cases
 	errCases := []string{
 		testMessedUpPrivateKey,  // a few lines deleted
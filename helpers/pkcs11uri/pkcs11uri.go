@@ -2,7 +2,9 @@
 // are currently specified in the draft RFC
 // http://datatracker.ietf.org/doc/draft-pechanec-pkcs11uri/
 //
-// Note that the only supported pin source at this time is via a file.
+// Note that the only supported pin source at this time is via a file;
+// a pin value may also be an env:NAME or file:/path reference, as
+// described for config.ResolveSecret.
 package pkcs11uri
 
 import (
@@ -10,6 +12,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/signer/pkcs11"
 )
@@ -50,6 +53,12 @@ func ParsePKCS11URI(uri string) (*pkcs11.Config, error) {
 	setIfPresent(pk11QAttr, "pin-value", &c.PIN)
 	setIfPresent(pk11PAttr, "slot-description", &c.Label)
 
+	// The PIN value may refer to a secret kept elsewhere, such as
+	// env:NAME or file:/path.
+	if c.PIN, err = config.ResolveSecret(c.PIN); err != nil {
+		return nil, ErrInvalidURI
+	}
+
 	var pinSourceURI string
 	setIfPresent(pk11QAttr, "pin-source", &pinSourceURI)
 	if pinSourceURI == "" {
@@ -2,6 +2,7 @@ package pkcs11uri
 
 import (
 	"fmt"
+	"os"
 	"testing"
 
 	"github.com/cloudflare/cfssl/signer/pkcs11"
@@ -105,3 +106,25 @@ func TestParsePKCS11URIFail(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePKCS11URIPINReference(t *testing.T) {
+	os.Setenv("CFSSL_TEST_PKCS11_PIN", "654321")
+	defer os.Unsetenv("CFSSL_TEST_PKCS11_PIN")
+
+	for uri, pin := range map[string]string{
+		"pkcs11:token=test-token?pin-value=env:CFSSL_TEST_PKCS11_PIN": "654321",
+		"pkcs11:token=test-token?pin-value=file:testdata/pin":         "123456",
+	} {
+		cfg, err := ParsePKCS11URI(uri)
+		if err != nil {
+			t.Fatalf("%s: %v", uri, err)
+		}
+		if cfg.PIN != pin {
+			t.Fatalf("%s: expected PIN %s, have %s", uri, pin, cfg.PIN)
+		}
+	}
+
+	if _, err := ParsePKCS11URI("pkcs11:token=test-token?pin-value=env:CFSSL_TEST_UNSET"); err == nil {
+		t.Fatal("expected an error for an unset PIN variable")
+	}
+}
@@ -3,10 +3,8 @@
 package initca
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
+	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -70,7 +68,7 @@ func New(req *csr.CertificateRequest) (cert, csrPEM, key []byte, err error) {
 		return
 	}
 
-	s, err := local.NewSigner(priv, nil, signer.DefaultSigAlgo(priv), nil)
+	s, err := local.NewSigner(priv, nil, caSigAlgo(priv, req.KeyRequest), nil)
 	if err != nil {
 		log.Errorf("failed to create signer: %v", err)
 		return
@@ -107,39 +105,16 @@ func NewFromPEM(req *csr.CertificateRequest, keyFile string) (cert []byte, err e
 		return nil, err
 	}
 
-	var sigAlgo x509.SignatureAlgorithm
-	switch priv := priv.(type) {
-	case *rsa.PrivateKey:
-		bitLength := priv.PublicKey.N.BitLen()
-		switch {
-		case bitLength >= 4096:
-			sigAlgo = x509.SHA512WithRSA
-		case bitLength >= 3072:
-			sigAlgo = x509.SHA384WithRSA
-		case bitLength >= 2048:
-			sigAlgo = x509.SHA256WithRSA
-		default:
-			sigAlgo = x509.SHA1WithRSA
-		}
-	case *ecdsa.PrivateKey:
-		switch priv.Curve {
-		case elliptic.P521():
-			sigAlgo = x509.ECDSAWithSHA512
-		case elliptic.P384():
-			sigAlgo = x509.ECDSAWithSHA384
-		case elliptic.P256():
-			sigAlgo = x509.ECDSAWithSHA256
-		default:
-			sigAlgo = x509.ECDSAWithSHA1
-		}
-	default:
-		sigAlgo = x509.UnknownSignatureAlgorithm
-	}
+	sigAlgo := caSigAlgo(priv, req.KeyRequest)
 
+	sans := csr.ParseHosts(req.Hosts)
 	var tpl = x509.CertificateRequest{
 		Subject:            req.Name(),
 		SignatureAlgorithm: sigAlgo,
-		DNSNames:           req.Hosts,
+		DNSNames:           sans.DNSNames,
+		IPAddresses:        sans.IPAddresses,
+		EmailAddresses:     sans.EmailAddresses,
+		URIs:               sans.URIs,
 	}
 
 	certReq, err := x509.CreateCertificateRequest(rand.Reader, &tpl, priv)
@@ -160,7 +135,7 @@ func NewFromPEM(req *csr.CertificateRequest, keyFile string) (cert []byte, err e
 	}
 	certReq = pem.EncodeToMemory(p)
 
-	s, err := local.NewSigner(priv, nil, signer.DefaultSigAlgo(priv), nil)
+	s, err := local.NewSigner(priv, nil, sigAlgo, nil)
 	if err != nil {
 		log.Errorf("failed to create signer: %v", err)
 		return
@@ -172,6 +147,16 @@ func NewFromPEM(req *csr.CertificateRequest, keyFile string) (cert []byte, err e
 	return
 }
 
+// caSigAlgo returns the signature algorithm for a CA with the given
+// private key. RSA keys sign with RSASSA-PSS when the key request
+// asks for "rsa-pss".
+func caSigAlgo(priv crypto.Signer, kr *csr.KeyRequest) x509.SignatureAlgorithm {
+	if kr != nil && kr.Algo == "rsa-pss" {
+		return signer.DefaultPSSSigAlgo(priv)
+	}
+	return signer.DefaultSigAlgo(priv)
+}
+
 // CAPolicy contains the CA issuing policy as default policy.
 var CAPolicy = &config.Signing{
 	Default: &config.SigningProfile{
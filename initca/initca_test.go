@@ -2,6 +2,7 @@ package initca
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"io/ioutil"
 	"strings"
@@ -45,6 +46,13 @@ var validKeyParams = []KeyRequest{
 		keyAlgo: "ecdsa",
 		keyLen:  521,
 	},
+	{
+		keyAlgo: "rsa-pss",
+		keyLen:  2048,
+	},
+	{
+		keyAlgo: "ed25519",
+	},
 }
 
 var csrFiles = []string{
@@ -70,6 +78,10 @@ var invalidCryptoParams = []KeyRequest{
 		keyAlgo: "ecdsa",
 		keyLen:  2000,
 	},
+	{
+		keyAlgo: "ed25519",
+		keyLen:  448,
+	},
 }
 
 func TestInitCA(t *testing.T) {
@@ -108,7 +120,7 @@ func TestInitCA(t *testing.T) {
 
 		// Verify key parameters.
 		switch req.KeyRequest.Algo {
-		case "rsa":
+		case "rsa", "rsa-pss":
 			if cert.PublicKey.(*rsa.PublicKey).N.BitLen() != param.keyLen {
 				t.Fatal("Cert key length mismatch.")
 			}
@@ -122,6 +134,16 @@ func TestInitCA(t *testing.T) {
 			if key.(*ecdsa.PrivateKey).Curve.Params().BitSize != param.keyLen {
 				t.Fatal("Private key length mismatch.")
 			}
+		case "ed25519":
+			if _, ok := cert.PublicKey.(ed25519.PublicKey); !ok {
+				t.Fatal("Cert key type mismatch.")
+			}
+			if _, ok := key.(ed25519.PrivateKey); !ok {
+				t.Fatal("Private key type mismatch.")
+			}
+		}
+		if cert.SignatureAlgorithm != req.KeyRequest.SigAlgo() {
+			t.Fatalf("Cert signature algorithm is %v, expected %v", cert.SignatureAlgorithm, req.KeyRequest.SigAlgo())
 		}
 
 		// Start a signer
@@ -0,0 +1,189 @@
+package ocsp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// The following ASN.1 structures are those of RFC 6960 for the parts
+// of OCSP requests and responses that golang.org/x/crypto/ocsp does
+// not expose: the certificate ID of a response, and request and
+// response extensions such as the nonce.
+
+type ocspRequest struct {
+	TBSRequest tbsRequest
+}
+
+type tbsRequest struct {
+	Version           int              `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName     pkix.RDNSequence `asn1:"explicit,tag:1,optional"`
+	RequestList       []asn1.RawValue
+	RequestExtensions []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+type responseASN1 struct {
+	Status   asn1.Enumerated
+	Response responseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type responseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type basicResponse struct {
+	TBSResponseData    responseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type responseData struct {
+	Version            int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID     asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          []asn1.RawValue
+	ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type singleResponse struct {
+	CertID certID
+}
+
+type certID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+// idPKIXOCSPNonce is the OID of the OCSP nonce extension.
+var idPKIXOCSPNonce = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+// signatureHashes maps the OIDs of the signature algorithms used for
+// OCSP responses to their hash functions. These are the RSA PKCS #1
+// v1.5 and ECDSA algorithms that ocsp.CreateResponse signs with;
+// NewSigner refuses keys, such as Ed25519 keys, that would need others.
+var signatureHashes = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, crypto.SHA1},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, crypto.SHA256},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, crypto.SHA384},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, crypto.SHA512},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, crypto.SHA1},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, crypto.SHA256},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, crypto.SHA384},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, crypto.SHA512},
+}
+
+// parseBasicResponse decodes the basic response carried in a
+// DER-encoded OCSP response.
+func parseBasicResponse(der []byte) (*responseASN1, *basicResponse, error) {
+	var resp responseASN1
+	if _, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, nil, err
+	}
+
+	var basicResp basicResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basicResp); err != nil {
+		return nil, nil, err
+	}
+
+	return &resp, &basicResp, nil
+}
+
+// responseCertID returns the identity of the certificate a
+// DER-encoded OCSP response is for.
+func responseCertID(der []byte) (*certID, error) {
+	_, basicResp, err := parseBasicResponse(der)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(basicResp.TBSResponseData.Responses) != 1 {
+		return nil, errors.New("OCSP response must contain exactly one response")
+	}
+
+	var single singleResponse
+	if _, err = asn1.Unmarshal(basicResp.TBSResponseData.Responses[0].FullBytes, &single); err != nil {
+		return nil, err
+	}
+
+	return &single.CertID, nil
+}
+
+// requestNonce returns the nonce extension of a DER-encoded OCSP
+// request, if it has one.
+func requestNonce(der []byte) (*pkix.Extension, error) {
+	var req ocspRequest
+	if _, err := asn1.Unmarshal(der, &req); err != nil {
+		return nil, err
+	}
+
+	for _, ext := range req.TBSRequest.RequestExtensions {
+		if ext.Id.Equal(idPKIXOCSPNonce) {
+			nonce := ext
+			return &nonce, nil
+		}
+	}
+	return nil, nil
+}
+
+// responseExtensions returns the responseExtensions of a DER-encoded
+// OCSP response.
+func responseExtensions(der []byte) ([]pkix.Extension, error) {
+	_, basicResp, err := parseBasicResponse(der)
+	if err != nil {
+		return nil, err
+	}
+	return basicResp.TBSResponseData.ResponseExtensions, nil
+}
+
+// addResponseExtensions adds extensions to the responseExtensions of a
+// DER-encoded OCSP response and signs it again with key, using the
+// response's signature algorithm.
+func addResponseExtensions(der []byte, key crypto.Signer, exts []pkix.Extension) ([]byte, error) {
+	resp, basicResp, err := parseBasicResponse(der)
+	if err != nil {
+		return nil, err
+	}
+
+	var hash crypto.Hash
+	for _, sh := range signatureHashes {
+		if sh.oid.Equal(basicResp.SignatureAlgorithm.Algorithm) {
+			hash = sh.hash
+			break
+		}
+	}
+	if hash == 0 {
+		return nil, errors.New("unsupported OCSP response signature algorithm")
+	}
+
+	tbs := &basicResp.TBSResponseData
+	tbs.ResponseExtensions = append(tbs.ResponseExtensions, exts...)
+	tbsDER, err := asn1.Marshal(*tbs)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hash.New()
+	h.Write(tbsDER)
+	signature, err := key.Sign(rand.Reader, h.Sum(nil), hash)
+	if err != nil {
+		return nil, err
+	}
+	basicResp.Signature = asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)}
+
+	resp.Response.Response, err = asn1.Marshal(*basicResp)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(*resp)
+}
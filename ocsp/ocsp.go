@@ -10,10 +10,16 @@ package ocsp
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"io/ioutil"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/cloudflare/cfssl/certdb"
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
@@ -26,13 +32,96 @@ var statusCode = map[string]int{
 	"unknown": ocsp.Unknown,
 }
 
+// revocationReasonCodes maps the lowercased names of the RFC 5280
+// CRLReason values to their codes.
+var revocationReasonCodes = map[string]int{
+	"unspecified":          ocsp.Unspecified,
+	"keycompromise":        ocsp.KeyCompromise,
+	"cacompromise":         ocsp.CACompromise,
+	"affiliationchanged":   ocsp.AffiliationChanged,
+	"superseded":           ocsp.Superseded,
+	"cessationofoperation": ocsp.CessationOfOperation,
+	"certificatehold":      ocsp.CertificateHold,
+	"removefromcrl":        ocsp.RemoveFromCRL,
+	"privilegewithdrawn":   ocsp.PrivilegeWithdrawn,
+	"aacompromise":         ocsp.AACompromise,
+}
+
+// ReasonStringToCode converts a revocation reason, given either as a
+// numeric code or as an RFC 5280 reason name such as "keyCompromise",
+// into its reason code. Names are matched case-insensitively and an
+// empty string means unspecified.
+func ReasonStringToCode(reason string) (int, error) {
+	if reason == "" {
+		return ocsp.Unspecified, nil
+	}
+
+	code, ok := revocationReasonCodes[strings.ToLower(reason)]
+	if !ok {
+		var err error
+		code, err = strconv.Atoi(reason)
+		if err != nil {
+			return 0, cferr.New(cferr.OCSPError, cferr.InvalidReason)
+		}
+	}
+
+	// Code 7 is not used by RFC 5280.
+	if code < ocsp.Unspecified || code > ocsp.AACompromise || code == 7 {
+		return 0, cferr.New(cferr.OCSPError, cferr.InvalidReason)
+	}
+
+	return code, nil
+}
+
 // SignRequest represents the desired contents of a
-// specific OCSP response.
+// specific OCSP response. Extensions are added to the
+// responseExtensions of the response; they are used to echo the nonce
+// of an OCSP request.
 type SignRequest struct {
 	Certificate *x509.Certificate
 	Status      string
 	Reason      int
 	RevokedAt   time.Time
+	Extensions  []pkix.Extension
+}
+
+// NewSignRequestFromRecord builds the SignRequest describing the
+// current status of the certificate held in a certificate store
+// record.
+func NewSignRequestFromRecord(cr certdb.CertificateRecord) (SignRequest, error) {
+	cert, err := helpers.ParseCertificatePEM([]byte(cr.PEM))
+	if err != nil {
+		return SignRequest{}, err
+	}
+
+	req := SignRequest{
+		Certificate: cert,
+		Status:      cr.Status,
+	}
+	if cr.Status == certdb.StatusRevoked {
+		req.Reason = cr.Reason
+		req.RevokedAt = cr.RevokedAt
+	}
+
+	return req, nil
+}
+
+// NewOCSPRecord builds the certificate store record for a signed,
+// DER-encoded OCSP response for a certificate issued under the
+// authority key identifier aki. The record expires at the response's
+// nextUpdate.
+func NewOCSPRecord(aki string, resp []byte) (certdb.OCSPRecord, error) {
+	parsed, err := ocsp.ParseResponse(resp, nil)
+	if err != nil {
+		return certdb.OCSPRecord{}, err
+	}
+
+	return certdb.OCSPRecord{
+		Serial: parsed.SerialNumber.String(),
+		AKI:    aki,
+		Body:   resp,
+		Expiry: parsed.NextUpdate,
+	}, nil
 }
 
 // Signer represents a general signer of OCSP responses.  It is
@@ -93,8 +182,16 @@ func NewSignerFromFile(issuerFile, responderFile, keyFile string, interval time.
 }
 
 // NewSigner simply constructs a new StandardSigner object from the inputs,
-// taking the interval in seconds
+// taking the interval in seconds. The key must be an RSA or ECDSA key:
+// responses are signed with RSA PKCS #1 v1.5 or ECDSA, which are also
+// the only algorithms used to sign them again when a nonce is echoed.
 func NewSigner(issuer, responder *x509.Certificate, key crypto.Signer, interval time.Duration) (Signer, error) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, cferr.New(cferr.PrivateKeyError, cferr.NotRSAOrECC)
+	}
+
 	return &StandardSigner{
 		issuer:    issuer,
 		responder: responder,
@@ -140,5 +237,10 @@ func (s StandardSigner) Sign(req SignRequest) ([]byte, error) {
 		template.RevocationReason = req.Reason
 	}
 
-	return ocsp.CreateResponse(s.issuer, s.responder, template, s.key)
+	resp, err := ocsp.CreateResponse(s.issuer, s.responder, template, s.key)
+	if err != nil || len(req.Extensions) == 0 {
+		return resp, err
+	}
+
+	return addResponseExtensions(resp, s.key, req.Extensions)
 }
@@ -1,11 +1,18 @@
 package ocsp
 
 import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
 	"io/ioutil"
 	"testing"
 	"time"
 
+	"github.com/cloudflare/cfssl/certdb"
+	certsql "github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
 	"github.com/cloudflare/cfssl/helpers"
+	"golang.org/x/crypto/ocsp"
 )
 
 const (
@@ -119,6 +126,62 @@ func TestSign(t *testing.T) {
 	}
 }
 
+func TestReasonStringToCode(t *testing.T) {
+	var tests = []struct {
+		reason string
+		code   int
+	}{
+		{"", 0},
+		{"1", 1},
+		{"keyCompromise", 1},
+		{"KEYCOMPROMISE", 1},
+		{"superseded", 4},
+		{"aACompromise", 10},
+	}
+	for _, test := range tests {
+		code, err := ReasonStringToCode(test.reason)
+		if err != nil {
+			t.Fatalf("%q: %v", test.reason, err)
+		}
+		if code != test.code {
+			t.Fatalf("%q: expected code %d, got %d", test.reason, test.code, code)
+		}
+	}
+
+	for _, reason := range []string{"7", "11", "-1", "notAReason"} {
+		if _, err := ReasonStringToCode(reason); err == nil {
+			t.Fatalf("%q: expected an error", reason)
+		}
+	}
+}
+
+func TestNewSignRequestFromRecord(t *testing.T) {
+	certPEM, err := ioutil.ReadFile(otherCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revokedAt := time.Now().UTC()
+	cr := certdb.CertificateRecord{
+		Status:    certdb.StatusRevoked,
+		Reason:    1,
+		RevokedAt: revokedAt,
+		PEM:       string(certPEM),
+	}
+	req, err := NewSignRequestFromRecord(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Certificate == nil || req.Status != "revoked" || req.Reason != 1 || !req.RevokedAt.Equal(revokedAt) {
+		t.Fatalf("bad sign request: %+v", req)
+	}
+
+	cr.PEM = "not a certificate"
+	if _, err = NewSignRequestFromRecord(cr); err == nil {
+		t.Fatal("expected an error for a malformed certificate")
+	}
+}
+
 func TestNewSourceFromFile(t *testing.T) {
 	_, err := NewSourceFromFile("")
 	if err == nil {
@@ -149,3 +212,88 @@ func TestNewSourceFromFile(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestDBSource(t *testing.T) {
+	s, err := NewSignerFromFile(serverCertFile, serverCertFile, serverKeyFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := ioutil.ReadFile(otherCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerPEM, err := ioutil.ReadFile(serverCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := helpers.ParseCertificatePEM(issuerPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dba := certsql.NewAccessor(testdb.SQLiteDB())
+	src := NewDBSource(dba)
+
+	reqBytes, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := ocsp.ParseRequest(reqBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := src.Response(req); found {
+		t.Fatal("found a response in an empty store")
+	}
+
+	resp, err := s.Sign(SignRequest{Certificate: cert, Status: "good"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := NewOCSPRecord(hex.EncodeToString(cert.AuthorityKeyId), resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.Serial != cert.SerialNumber.String() {
+		t.Fatalf("record has serial %s, expected %s", rr.Serial, cert.SerialNumber)
+	}
+	if err = dba.UpsertOCSP(rr); err != nil {
+		t.Fatal(err)
+	}
+
+	found, ok := src.Response(req)
+	if !ok {
+		t.Fatal("stored response was not found")
+	}
+	if !bytes.Equal(found, resp) {
+		t.Fatal("wrong response served")
+	}
+
+	// Only SHA-1 issuer key hashes can be matched against the AKI.
+	reqBytes, err = ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: crypto.SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha256Req, err := ocsp.ParseRequest(reqBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := src.Response(sha256Req); found {
+		t.Fatal("served a response for a SHA-256 issuer key hash")
+	}
+
+	// Expired responses are not served.
+	rr.Expiry = time.Now().Add(-time.Minute)
+	if err = dba.UpsertOCSP(rr); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := src.Response(req); found {
+		t.Fatal("served an expired response")
+	}
+}
@@ -0,0 +1,87 @@
+package ocsp
+
+import (
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/log"
+	"golang.org/x/crypto/ocsp"
+)
+
+// needsRefresh reports whether the stored responses for a certificate
+// record must be replaced: there is no usable response, the response
+// expires before the deadline, or it no longer reflects the
+// certificate's status.
+func needsRefresh(cr certdb.CertificateRecord, rrs []certdb.OCSPRecord, deadline time.Time) bool {
+	if len(rrs) == 0 || rrs[0].Expiry.Before(deadline) {
+		return true
+	}
+
+	resp, err := ocsp.ParseResponse(rrs[0].Body, nil)
+	if err != nil {
+		return true
+	}
+
+	status, ok := statusCode[cr.Status]
+	return !ok || resp.Status != status
+}
+
+// Refresh signs new OCSP responses for the unexpired certificates in
+// the certificate store that were issued under the authority key
+// identifier aki, and stores them. A certificate gets a new response
+// if it has none, if its response expires within threshold, or if its
+// response doesn't match its current status. Refresh returns the number
+// of responses it stored; failures for individual certificates are
+// logged and skipped.
+func Refresh(dbAccessor certdb.Accessor, signer Signer, aki string, threshold time.Duration) (int, error) {
+	crs, err := dbAccessor.GetUnexpiredCertificates()
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(threshold)
+	count := 0
+	for _, cr := range crs {
+		if cr.AKI != aki {
+			continue
+		}
+
+		rrs, err := dbAccessor.GetOCSP(cr.Serial, cr.AKI)
+		if err != nil {
+			log.Errorf("failed to look up OCSP response for %s: %v", cr.Serial, err)
+			continue
+		}
+
+		if !needsRefresh(cr, rrs, deadline) {
+			continue
+		}
+
+		req, err := NewSignRequestFromRecord(cr)
+		if err != nil {
+			log.Errorf("failed to parse certificate %s: %v", cr.Serial, err)
+			continue
+		}
+
+		resp, err := signer.Sign(req)
+		if err != nil {
+			log.Errorf("failed to sign OCSP response for %s: %v", cr.Serial, err)
+			continue
+		}
+
+		rr, err := NewOCSPRecord(cr.AKI, resp)
+		if err != nil {
+			log.Errorf("failed to parse OCSP response for %s: %v", cr.Serial, err)
+			continue
+		}
+
+		err = dbAccessor.UpsertOCSP(rr)
+		if err != nil {
+			log.Errorf("failed to store OCSP response for %s: %v", cr.Serial, err)
+			continue
+		}
+		count++
+	}
+
+	log.Infof("refreshed %d OCSP responses", count)
+	return count, nil
+}
@@ -0,0 +1,113 @@
+package ocsp
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	certsql "github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	"github.com/cloudflare/cfssl/helpers"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestRefresh(t *testing.T) {
+	s, err := NewSignerFromFile(serverCertFile, serverCertFile, serverKeyFile, 96*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := ioutil.ReadFile(otherCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aki := hex.EncodeToString(cert.AuthorityKeyId)
+
+	dba := certsql.NewAccessor(testdb.SQLiteDB())
+	cr := certdb.CertificateRecord{
+		Serial: cert.SerialNumber.String(),
+		AKI:    aki,
+		Status: certdb.StatusGood,
+		Expiry: time.Now().Add(time.Hour),
+		PEM:    string(certPEM),
+	}
+	if err = dba.InsertCertificate(cr); err != nil {
+		t.Fatal(err)
+	}
+
+	// Certificates from other issuers are left alone.
+	if err = dba.InsertCertificate(certdb.CertificateRecord{
+		Serial: "1",
+		AKI:    "other",
+		Status: certdb.StatusGood,
+		Expiry: time.Now().Add(time.Hour),
+		PEM:    string(certPEM),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// With no stored response, one is signed.
+	count, err := Refresh(dba, s, aki, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 refreshed response, got %d", count)
+	}
+
+	rrs, err := dba.GetOCSP(cr.Serial, aki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 1 {
+		t.Fatal("refreshed response was not stored")
+	}
+
+	// A fresh response is kept.
+	count, err = Refresh(dba, s, aki, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("expected no refreshed responses, got %d", count)
+	}
+
+	// A response expiring within the threshold is replaced.
+	count, err = Refresh(dba, s, aki, 200*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 refreshed response, got %d", count)
+	}
+
+	// A response that doesn't reflect a revocation is replaced.
+	if err = dba.RevokeCertificate(cr.Serial, aki, ocsp.KeyCompromise); err != nil {
+		t.Fatal(err)
+	}
+	count, err = Refresh(dba, s, aki, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 refreshed response, got %d", count)
+	}
+
+	rrs, err = dba.GetOCSP(cr.Serial, aki)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ocsp.ParseResponse(rrs[0].Body, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != ocsp.Revoked || resp.RevocationReason != ocsp.KeyCompromise {
+		t.Fatal("refreshed response does not reflect revocation")
+	}
+}
@@ -1,12 +1,20 @@
 package ocsp
 
 import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
+	"time"
 
+	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/log"
 	"golang.org/x/crypto/ocsp"
 )
@@ -27,14 +35,30 @@ type Source interface {
 	Response(*ocsp.Request) ([]byte, bool)
 }
 
-// An InMemorySource is a map from serialNumber -> der(response)
-type InMemorySource map[string][]byte
+// A NonceSource is a Source that can echo the nonce extension of a
+// request in the response it provides. Sources of pre-signed responses
+// cannot do so, and requests sent to them have their nonces ignored.
+type NonceSource interface {
+	Source
+	ResponseWithNonce(request *ocsp.Request, nonce pkix.Extension) ([]byte, bool)
+}
+
+// An InMemorySource is a map from the hex-encoded issuer key hash of
+// an issuer to a map from serialNumber -> der(response) for the
+// certificates of that issuer. Keying on the issuer lets one source
+// serve responses for several CAs whose serial numbers may collide.
+type InMemorySource map[string]map[string][]byte
 
-// Response looks up an OCSP response to provide for a given request.
-// InMemorySource looks up a response purely based on serial number,
-// without regard to what issuer the request is asking for.
+// Response looks up an OCSP response to provide for a given request,
+// based on the issuer key hash and serial number of the request. The
+// request's issuer key hash must be computed with the same hash
+// algorithm as the one in the stored response (normally SHA-1).
 func (src InMemorySource) Response(request *ocsp.Request) (response []byte, present bool) {
-	response, present = src[request.SerialNumber.String()]
+	responses, present := src[hex.EncodeToString(request.IssuerKeyHash)]
+	if !present {
+		return
+	}
+	response, present = responses[request.SerialNumber.String()]
 	return
 }
 
@@ -42,7 +66,8 @@ func (src InMemorySource) Response(request *ocsp.Request) (response []byte, pres
 // The file read by this function must contain whitespace-separated OCSP
 // responses. Each OCSP response must be in base64-encoded DER form (i.e.,
 // PEM without headers or whitespace).  Invalid responses are ignored.
-// This function pulls the entire file into an InMemorySource.
+// Responses are indexed by the issuer key hash and serial number they
+// carry. This function pulls the entire file into an InMemorySource.
 func NewSourceFromFile(responseFile string) (Source, error) {
 	fileContents, err := ioutil.ReadFile(responseFile)
 	if err != nil {
@@ -51,6 +76,7 @@ func NewSourceFromFile(responseFile string) (Source, error) {
 
 	responsesB64 := regexp.MustCompile("\\s").Split(string(fileContents), -1)
 	src := InMemorySource{}
+	count := 0
 	for _, b64 := range responsesB64 {
 		der, tmpErr := base64.StdEncoding.DecodeString(b64)
 		if tmpErr != nil {
@@ -58,19 +84,132 @@ func NewSourceFromFile(responseFile string) (Source, error) {
 			continue
 		}
 
-		response, tmpErr := ocsp.ParseResponse(der, nil)
+		_, tmpErr = ocsp.ParseResponse(der, nil)
 		if tmpErr != nil {
 			log.Errorf("OCSP decode error on: %s", b64)
 			continue
 		}
 
-		src[response.SerialNumber.String()] = der
+		id, tmpErr := responseCertID(der)
+		if tmpErr != nil {
+			log.Errorf("OCSP certificate ID decode error on: %s", b64)
+			continue
+		}
+
+		issuer := hex.EncodeToString(id.IssuerKeyHash)
+		if src[issuer] == nil {
+			src[issuer] = map[string][]byte{}
+		}
+		src[issuer][id.SerialNumber.String()] = der
+		count++
 	}
 
-	log.Infof("Read %d OCSP responses", len(src))
+	log.Infof("Read %d OCSP responses for %d issuers", count, len(src))
 	return src, nil
 }
 
+// A DBSource serves OCSP responses stored in a certificate store,
+// keyed on the certificate's serial number and the authority key
+// identifier of its issuer. Since responses are looked up for every
+// request, newly stored responses are served immediately.
+//
+// The issuer is matched by comparing the request's issuer key hash
+// with the stored authority key identifier, so requests must use
+// SHA-1 and the issuer's subject key identifier must be the SHA-1 hash
+// of its public key (as in certificates created by CFSSL).
+type DBSource struct {
+	Accessor certdb.Accessor
+}
+
+// NewDBSource creates a new DBSource serving responses from the
+// certificate store accessed through dbAccessor.
+func NewDBSource(dbAccessor certdb.Accessor) Source {
+	return DBSource{Accessor: dbAccessor}
+}
+
+// Response looks up the stored OCSP response for a given request.
+// Responses whose nextUpdate has passed are not served.
+func (src DBSource) Response(request *ocsp.Request) ([]byte, bool) {
+	if request.HashAlgorithm != crypto.SHA1 {
+		return nil, false
+	}
+
+	serial := request.SerialNumber.String()
+	aki := hex.EncodeToString(request.IssuerKeyHash)
+	records, err := src.Accessor.GetOCSP(serial, aki)
+	if err != nil {
+		log.Errorf("Error looking up OCSP response for %s: %v", serial, err)
+		return nil, false
+	}
+
+	if len(records) == 0 || !time.Now().Before(records[0].Expiry) {
+		return nil, false
+	}
+
+	return records[0].Body, true
+}
+
+// A SignerSource signs a fresh OCSP response for every request, using
+// the status of the certificate recorded in a certificate store. As
+// with DBSource, certificates are looked up by serial number and by
+// the SHA-1 issuer key hash of the request, which must match their
+// authority key identifier. Responses echo the nonce of the request,
+// if there is one.
+type SignerSource struct {
+	Signer   Signer
+	Accessor certdb.Accessor
+}
+
+// NewSignerSource creates a new SignerSource that signs responses with
+// signer for the certificates in the certificate store accessed
+// through dbAccessor.
+func NewSignerSource(signer Signer, dbAccessor certdb.Accessor) NonceSource {
+	return SignerSource{Signer: signer, Accessor: dbAccessor}
+}
+
+// Response signs a new OCSP response for a given request.
+func (src SignerSource) Response(request *ocsp.Request) ([]byte, bool) {
+	return src.sign(request, nil)
+}
+
+// ResponseWithNonce signs a new OCSP response for a given request,
+// including its nonce.
+func (src SignerSource) ResponseWithNonce(request *ocsp.Request, nonce pkix.Extension) ([]byte, bool) {
+	return src.sign(request, []pkix.Extension{nonce})
+}
+
+func (src SignerSource) sign(request *ocsp.Request, exts []pkix.Extension) ([]byte, bool) {
+	if request.HashAlgorithm != crypto.SHA1 {
+		return nil, false
+	}
+
+	serial := request.SerialNumber.String()
+	aki := hex.EncodeToString(request.IssuerKeyHash)
+	records, err := src.Accessor.GetCertificate(serial, aki)
+	if err != nil {
+		log.Errorf("Error looking up certificate %s: %v", serial, err)
+		return nil, false
+	}
+	if len(records) == 0 {
+		return nil, false
+	}
+
+	req, err := NewSignRequestFromRecord(records[0])
+	if err != nil {
+		log.Errorf("Error parsing certificate %s: %v", serial, err)
+		return nil, false
+	}
+	req.Extensions = exts
+
+	response, err := src.Signer.Sign(req)
+	if err != nil {
+		log.Errorf("Error signing OCSP response for %s: %v", serial, err)
+		return nil, false
+	}
+
+	return response, true
+}
+
 // A Responder object provides the HTTP logic to expose a
 // Source of OCSP responses.
 type Responder struct {
@@ -116,10 +255,8 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 	// seems unnecessariliy restrictive.
 	response.Header().Add("Content-Type", "application/ocsp-response")
 
-	// Parse response as an OCSP request
-	// XXX: This fails if the request contains the nonce extension.
-	//      We don't intend to support nonces anyway, but maybe we
-	//      should return unauthorizedRequest instead of malformed.
+	// Parse response as an OCSP request. Request extensions are
+	// ignored here; the nonce is extracted separately below.
 	ocspRequest, err := ocsp.ParseRequest(requestBody)
 	if err != nil {
 		log.Errorf("Error decoding request body: %s", b64Body)
@@ -127,15 +264,85 @@ func (rs Responder) ServeHTTP(response http.ResponseWriter, request *http.Reques
 		return
 	}
 
-	// Look up OCSP response from source
-	ocspResponse, found := rs.Source.Response(ocspRequest)
+	// Look up OCSP response from source, echoing the nonce if the
+	// source is able to.
+	var ocspResponse []byte
+	var found, withNonce bool
+	nonce, err := requestNonce(requestBody)
+	if err != nil {
+		log.Errorf("Error decoding request extensions: %s", b64Body)
+	}
+	if nonceSource, ok := rs.Source.(NonceSource); ok && nonce != nil {
+		ocspResponse, found = nonceSource.ResponseWithNonce(ocspRequest, *nonce)
+		withNonce = true
+	} else {
+		ocspResponse, found = rs.Source.Response(ocspRequest)
+	}
 	if !found {
 		log.Errorf("No response found for request: %s", b64Body)
 		response.Write(unauthorizedErrorResponse)
 		return
 	}
 
+	// A response with a nonce is specific to its request and must not
+	// be cached. Otherwise, set the caching headers described in RFC
+	// 5019, section 6.2, and answer conditional requests.
+	if withNonce {
+		response.Header().Set("Cache-Control", "no-cache")
+	} else if parsed, err := ocsp.ParseResponse(ocspResponse, nil); err != nil {
+		log.Errorf("Error parsing OCSP response for caching headers: %v", err)
+	} else {
+		etag := fmt.Sprintf("\"%X\"", sha256.Sum256(ocspResponse))
+		setCacheHeaders(response.Header(), parsed, etag, time.Now())
+		if notModified(request, parsed.ThisUpdate, etag) {
+			response.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
 	// Write OCSP response to response
 	response.WriteHeader(http.StatusOK)
 	response.Write(ocspResponse)
 }
+
+// setCacheHeaders sets the HTTP caching headers for an OCSP response:
+// Last-Modified is its thisUpdate and Expires its nextUpdate, and it
+// may be cached until then.
+func setCacheHeaders(header http.Header, resp *ocsp.Response, etag string, now time.Time) {
+	header.Set("ETag", etag)
+	header.Set("Last-Modified", resp.ThisUpdate.UTC().Format(http.TimeFormat))
+
+	maxAge := 0
+	if !resp.NextUpdate.IsZero() {
+		header.Set("Expires", resp.NextUpdate.UTC().Format(http.TimeFormat))
+		if resp.NextUpdate.After(now) {
+			maxAge = int(resp.NextUpdate.Sub(now) / time.Second)
+		}
+	}
+	header.Set("Cache-Control", fmt.Sprintf("max-age=%d, public, no-transform, must-revalidate", maxAge))
+}
+
+// notModified reports whether a conditional request is satisfied by
+// the cached copy of a response with the given thisUpdate time and
+// ETag. If-None-Match takes precedence over If-Modified-Since.
+func notModified(request *http.Request, thisUpdate time.Time, etag string) bool {
+	if inm := request.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := request.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		return !thisUpdate.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
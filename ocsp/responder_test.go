@@ -0,0 +1,453 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	certsql "github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	"github.com/cloudflare/cfssl/helpers"
+	"golang.org/x/crypto/ocsp"
+)
+
+// newTestSource signs a response for the test certificate and loads it
+// through NewSourceFromFile, returning the source along with an OCSP
+// request for the certificate.
+func newTestSource(t *testing.T) (Source, []byte) {
+	s, err := NewSignerFromFile(serverCertFile, serverCertFile, serverKeyFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := ioutil.ReadFile(otherCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerPEM, err := ioutil.ReadFile(serverCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := helpers.ParseCertificatePEM(issuerPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.Sign(SignRequest{Certificate: cert, Status: "good"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "cfssl-ocsp-responses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(base64.StdEncoding.EncodeToString(resp) + "\n")
+	f.Close()
+
+	src, err := NewSourceFromFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src, req
+}
+
+func TestInMemorySourceIssuer(t *testing.T) {
+	src, reqBytes := newTestSource(t)
+
+	req, err := ocsp.ParseRequest(reqBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := src.Response(req); !found {
+		t.Fatal("response for a known issuer and serial not found")
+	}
+
+	// The same serial number under another issuer is a different
+	// certificate.
+	req.IssuerKeyHash = bytes.Repeat([]byte{0xff}, len(req.IssuerKeyHash))
+	if _, found := src.Response(req); found {
+		t.Fatal("response found for an unknown issuer")
+	}
+}
+
+func TestResponderUnknownIssuer(t *testing.T) {
+	src, reqBytes := newTestSource(t)
+
+	ts := httptest.NewServer(Responder{Source: src})
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "application/ocsp-request", bytes.NewReader(reqBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if _, err = ocsp.ParseResponse(body, nil); err != nil {
+		t.Fatalf("expected a valid OCSP response: %v", err)
+	}
+
+	req, err := ocsp.ParseRequest(reqBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.IssuerKeyHash = bytes.Repeat([]byte{0xff}, len(req.IssuerKeyHash))
+	reqBytes, err = req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = http.Post(ts.URL, "application/ocsp-request", bytes.NewReader(reqBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(body, unauthorizedErrorResponse) {
+		t.Fatalf("expected an unauthorized response, got %x", body)
+	}
+}
+
+// addNonce adds a nonce extension to a DER-encoded OCSP request.
+func addNonce(t *testing.T, reqBytes []byte, nonce []byte) ([]byte, pkix.Extension) {
+	var req ocspRequest
+	if _, err := asn1.Unmarshal(reqBytes, &req); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := asn1.Marshal(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := pkix.Extension{Id: idPKIXOCSPNonce, Value: value}
+	req.TBSRequest.RequestExtensions = []pkix.Extension{ext}
+
+	reqBytes, err = asn1.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reqBytes, ext
+}
+
+func postOCSPRequest(t *testing.T, url string, reqBytes []byte) []byte {
+	resp, err := http.Post(url, "application/ocsp-request", bytes.NewReader(reqBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestNonceIgnoredByPresignedSource(t *testing.T) {
+	src, reqBytes := newTestSource(t)
+	reqBytes, _ = addNonce(t, reqBytes, []byte("0123456789abcdef"))
+
+	ts := httptest.NewServer(Responder{Source: src})
+	defer ts.Close()
+
+	body := postOCSPRequest(t, ts.URL, reqBytes)
+	if _, err := ocsp.ParseResponse(body, nil); err != nil {
+		t.Fatalf("request with a nonce was not answered: %v", err)
+	}
+}
+
+func TestSignerSourceNonce(t *testing.T) {
+	s, err := NewSignerFromFile(serverCertFile, serverCertFile, serverKeyFile, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := ioutil.ReadFile(otherCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerPEM, err := ioutil.ReadFile(serverCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := helpers.ParseCertificatePEM(issuerPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dba := certsql.NewAccessor(testdb.SQLiteDB())
+	err = dba.InsertCertificate(certdb.CertificateRecord{
+		Serial: cert.SerialNumber.String(),
+		AKI:    hex.EncodeToString(cert.AuthorityKeyId),
+		Status: certdb.StatusGood,
+		Expiry: cert.NotAfter,
+		PEM:    string(certPEM),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(Responder{Source: NewSignerSource(s, dba)})
+	defer ts.Close()
+
+	reqBytes, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a nonce, a fresh response is signed.
+	body := postOCSPRequest(t, ts.URL, reqBytes)
+	resp, err := ocsp.ParseResponse(body, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != ocsp.Good {
+		t.Fatalf("expected status good, got %d", resp.Status)
+	}
+
+	// With a nonce, the response echoes it, is validly signed and
+	// must not be cached.
+	reqBytes, nonce := addNonce(t, reqBytes, []byte("0123456789abcdef"))
+	httpResp, err := http.Post(ts.URL, "application/ocsp-request", bytes.NewReader(reqBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if cc := httpResp.Header.Get("Cache-Control"); cc != "no-cache" {
+		t.Fatalf("expected Cache-Control: no-cache, got %q", cc)
+	}
+	if _, err = ocsp.ParseResponse(body, issuer); err != nil {
+		t.Fatal(err)
+	}
+
+	exts, err := responseExtensions(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exts) != 1 || !exts[0].Id.Equal(idPKIXOCSPNonce) || !bytes.Equal(exts[0].Value, nonce.Value) {
+		t.Fatalf("response does not echo the nonce: %v", exts)
+	}
+}
+
+func TestResponderCacheHeaders(t *testing.T) {
+	src, reqBytes := newTestSource(t)
+
+	ts := httptest.NewServer(Responder{Source: src})
+	defer ts.Close()
+
+	getURL := ts.URL + "/" + url.QueryEscape(base64.StdEncoding.EncodeToString(reqBytes))
+	get := func(header, value string) *http.Response {
+		req, err := http.NewRequest("GET", getURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get("", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" || lastModified == "" || resp.Header.Get("Expires") == "" {
+		t.Fatalf("caching headers missing: %v", resp.Header)
+	}
+	if cc := resp.Header.Get("Cache-Control"); !strings.HasPrefix(cc, "max-age=") || strings.HasPrefix(cc, "max-age=0,") {
+		t.Fatalf("bad Cache-Control header %q", cc)
+	}
+
+	expires, err := http.ParseTime(resp.Header.Get("Expires"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expires.After(modified) {
+		t.Fatal("Expires is not after Last-Modified")
+	}
+
+	if resp = get("If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("If-None-Match with the current ETag: expected 304, got %d", resp.StatusCode)
+	}
+	if resp = get("If-None-Match", `"stale"`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("If-None-Match with another ETag: expected 200, got %d", resp.StatusCode)
+	}
+	if resp = get("If-Modified-Since", lastModified); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("If-Modified-Since Last-Modified: expected 304, got %d", resp.StatusCode)
+	}
+
+	earlier := modified.Add(-time.Hour).Format(http.TimeFormat)
+	if resp = get("If-Modified-Since", earlier); resp.StatusCode != http.StatusOK {
+		t.Fatalf("If-Modified-Since before Last-Modified: expected 200, got %d", resp.StatusCode)
+	}
+}
+
+// newKeyTestPKI issues a CA certificate for key, signed with sigAlgo,
+// and an ECDSA leaf certificate under it.
+func newKeyTestPKI(t *testing.T, key crypto.Signer, sigAlgo x509.SignatureAlgorithm) (issuer, leaf *x509.Certificate, leafPEM []byte) {
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "OCSP test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SignatureAlgorithm:    sigAlgo,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuer, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber:       big.NewInt(2),
+		Subject:            pkix.Name{CommonName: "leaf.example.com"},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		SignatureAlgorithm: sigAlgo,
+	}
+	if der, err = x509.CreateCertificate(rand.Reader, leafTemplate, issuer, leafKey.Public(), key); err != nil {
+		t.Fatal(err)
+	}
+	if leaf, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return issuer, leaf, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestSignerSourceKeyTypes(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keyTypes = []struct {
+		name    string
+		key     crypto.Signer
+		sigAlgo x509.SignatureAlgorithm
+	}{
+		{"rsa", rsaKey, x509.SHA256WithRSA},
+		// A CA whose certificates are signed with RSA-PSS still signs
+		// OCSP responses with PKCS #1 v1.5.
+		{"rsa-pss", rsaKey, x509.SHA256WithRSAPSS},
+		{"ecdsa-p256", p256Key, x509.ECDSAWithSHA256},
+		{"ecdsa-p384", p384Key, x509.ECDSAWithSHA384},
+	}
+	for _, kt := range keyTypes {
+		issuer, leaf, leafPEM := newKeyTestPKI(t, kt.key, kt.sigAlgo)
+		s, err := NewSigner(issuer, issuer, kt.key, time.Hour)
+		if err != nil {
+			t.Fatalf("%s: %v", kt.name, err)
+		}
+
+		dba := certsql.NewAccessor(testdb.SQLiteDB())
+		err = dba.InsertCertificate(certdb.CertificateRecord{
+			Serial: leaf.SerialNumber.String(),
+			AKI:    hex.EncodeToString(leaf.AuthorityKeyId),
+			Status: certdb.StatusGood,
+			Expiry: leaf.NotAfter,
+			PEM:    string(leafPEM),
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", kt.name, err)
+		}
+
+		ts := httptest.NewServer(Responder{Source: NewSignerSource(s, dba)})
+		reqBytes, err := ocsp.CreateRequest(leaf, issuer, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", kt.name, err)
+		}
+		reqBytes, nonce := addNonce(t, reqBytes, []byte("0123456789abcdef"))
+		body := postOCSPRequest(t, ts.URL, reqBytes)
+		ts.Close()
+
+		resp, err := ocsp.ParseResponse(body, issuer)
+		if err != nil {
+			t.Fatalf("%s: %v", kt.name, err)
+		}
+		if resp.Status != ocsp.Good {
+			t.Fatalf("%s: expected status good, got %d", kt.name, resp.Status)
+		}
+		exts, err := responseExtensions(body)
+		if err != nil {
+			t.Fatalf("%s: %v", kt.name, err)
+		}
+		if len(exts) != 1 || !bytes.Equal(exts[0].Value, nonce.Value) {
+			t.Fatalf("%s: response does not echo the nonce: %v", kt.name, exts)
+		}
+	}
+
+	// An Ed25519 responder key is refused rather than failing on
+	// the first request.
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, _, _ := newKeyTestPKI(t, edKey, x509.PureEd25519)
+	if _, err = NewSigner(issuer, issuer, edKey, time.Hour); err == nil {
+		t.Fatal("an Ed25519 responder key should be refused")
+	}
+}
@@ -0,0 +1,257 @@
+package revoke
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+)
+
+const (
+	// DefaultCRLCacheSize is the number of CRLs a CRLCache holds
+	// when MaxEntries is not set.
+	DefaultCRLCacheSize = 64
+
+	// DefaultMaxCRLSize is the largest CRL, in bytes, that a CRLCache
+	// fetches when MaxCRLSize is not set.
+	DefaultMaxCRLSize = 32 << 20
+
+	// DefaultCRLTimeout is the time a CRLCache allows for fetching a
+	// CRL when Timeout is not set.
+	DefaultCRLTimeout = 30 * time.Second
+)
+
+// A CRLCache holds parsed CRLs keyed by the URL they are fetched
+// from. A cached CRL is used until its nextUpdate time has passed, at
+// which point it is fetched again. When the cache is full, the least
+// recently used CRL is evicted. If Dir is set, fetched CRLs are also
+// written there and read back when they aren't in memory, so that they
+// survive restarts. A CRLCache is safe for concurrent use; its
+// configuration fields must not be changed once it is in use.
+type CRLCache struct {
+	// MaxEntries is the maximum number of CRLs held in memory.
+	MaxEntries int
+	// MaxCRLSize is the maximum size, in bytes, of a fetched CRL.
+	MaxCRLSize int64
+	// Timeout bounds the time taken to fetch a CRL.
+	Timeout time.Duration
+	// Dir, if not empty, is a directory in which fetched CRLs are
+	// persisted.
+	Dir string
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type crlCacheEntry struct {
+	url string
+	crl *pkix.CertificateList
+}
+
+// NewCRLCache returns an empty in-memory CRLCache using the default
+// limits.
+func NewCRLCache() *CRLCache {
+	return &CRLCache{
+		MaxEntries: DefaultCRLCacheSize,
+		MaxCRLSize: DefaultMaxCRLSize,
+		Timeout:    DefaultCRLTimeout,
+	}
+}
+
+// Lookup returns the cached CRL for url, if there is one, whether or
+// not it has expired.
+func (c *CRLCache) Lookup(url string) (*pkix.CertificateList, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[url]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*crlCacheEntry).crl, true
+}
+
+// Set caches crl as the CRL for url in memory. Setting a nil CRL
+// removes url from the cache.
+func (c *CRLCache) Set(url string, crl *pkix.CertificateList) {
+	if crl == nil {
+		c.Delete(url)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]*list.Element{}
+		c.lru = list.New()
+	}
+
+	if e, ok := c.entries[url]; ok {
+		e.Value.(*crlCacheEntry).crl = crl
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.entries[url] = c.lru.PushFront(&crlCacheEntry{url: url, crl: crl})
+
+	max := c.MaxEntries
+	if max <= 0 {
+		max = DefaultCRLCacheSize
+	}
+	for c.lru.Len() > max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*crlCacheEntry).url)
+	}
+}
+
+// Delete removes the CRL for url from memory and from Dir.
+func (c *CRLCache) Delete(url string) {
+	c.mu.Lock()
+	if e, ok := c.entries[url]; ok {
+		c.lru.Remove(e)
+		delete(c.entries, url)
+	}
+	c.mu.Unlock()
+
+	if c.Dir != "" {
+		os.Remove(c.path(url))
+	}
+}
+
+// Len returns the number of CRLs held in memory.
+func (c *CRLCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Get returns an unexpired CRL for url, fetching it with f if the
+// cache has none; a nil f means helpers.DefaultFetcher. fromCache
+// reports whether the CRL was found in memory or in Dir rather than
+// fetched.
+func (c *CRLCache) Get(ctx context.Context, f helpers.Fetcher, url string) (crl *pkix.CertificateList, fromCache bool, err error) {
+	now := time.Now()
+	if crl, ok := c.Lookup(url); ok && !crl.HasExpired(now) {
+		return crl, true, nil
+	}
+
+	if c.Dir != "" {
+		if crl = c.load(url); crl != nil && !crl.HasExpired(now) {
+			c.Set(url, crl)
+			return crl, true, nil
+		}
+	}
+
+	body, err := c.fetch(ctx, f, url)
+	if err != nil {
+		return nil, false, err
+	}
+
+	crl, err = x509.ParseCRL(body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.Set(url, crl)
+	if c.Dir != "" {
+		c.store(url, body)
+	}
+	return crl, false, nil
+}
+
+// fetch retrieves the encoded CRL at url, within the cache's timeout
+// and size limits.
+func (c *CRLCache) fetch(ctx context.Context, f helpers.Fetcher, url string) ([]byte, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCRLTimeout
+	}
+	maxSize := c.MaxCRLSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxCRLSize
+	}
+
+	if f == nil {
+		f = helpers.DefaultFetcher
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := f.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, errors.New("CRL exceeds the maximum size")
+	}
+	return body, nil
+}
+
+// path returns the file in Dir that holds the CRL for url.
+func (c *CRLCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:])+".crl")
+}
+
+// load reads the CRL for url from Dir, returning nil if there is no
+// usable copy.
+func (c *CRLCache) load(url string) *pkix.CertificateList {
+	body, err := ioutil.ReadFile(c.path(url))
+	if err != nil {
+		return nil
+	}
+
+	crl, err := x509.ParseCRL(body)
+	if err != nil {
+		log.Warningf("discarding unparsable cached CRL for %s: %v", url, err)
+		os.Remove(c.path(url))
+		return nil
+	}
+	return crl
+}
+
+// store writes the encoded CRL for url to Dir. The file is written
+// under a temporary name and renamed, so concurrent readers never see
+// a partial CRL.
+func (c *CRLCache) store(url string, body []byte) {
+	tmp, err := ioutil.TempFile(c.Dir, ".crl")
+	if err != nil {
+		log.Warningf("failed to persist CRL for %s: %v", url, err)
+		return
+	}
+
+	_, err = tmp.Write(body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(url))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Warningf("failed to persist CRL for %s: %v", url, err)
+	}
+}
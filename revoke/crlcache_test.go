@@ -0,0 +1,173 @@
+package revoke
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCRLServer serves a CRL, signed by a new CA, that expires at
+// nextUpdate. It counts the requests it answers.
+func newCRLServer(t *testing.T, nextUpdate time.Time) (*httptest.Server, *int32) {
+	ca, caKey := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CRL CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+
+	crl, err := ca.CreateCRL(rand.Reader, caKey, nil, time.Now().Add(-time.Hour), nextUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(crl)
+	}))
+	return server, &requests
+}
+
+func TestCRLCacheRefresh(t *testing.T) {
+	fresh, freshRequests := newCRLServer(t, time.Now().Add(time.Hour))
+	defer fresh.Close()
+	stale, staleRequests := newCRLServer(t, time.Now().Add(-time.Minute))
+	defer stale.Close()
+
+	cache := NewCRLCache()
+	for i := 0; i < 3; i++ {
+		if _, fromCache, err := cache.Get(context.Background(), nil, fresh.URL); err != nil {
+			t.Fatal(err)
+		} else if fromCache != (i > 0) {
+			t.Fatalf("request %d: fromCache=%v", i, fromCache)
+		}
+		if _, fromCache, err := cache.Get(context.Background(), nil, stale.URL); err != nil {
+			t.Fatal(err)
+		} else if fromCache {
+			t.Fatal("an expired CRL should be fetched again")
+		}
+	}
+
+	if *freshRequests != 1 || *staleRequests != 3 {
+		t.Fatalf("expected 1 and 3 fetches, got %d and %d", *freshRequests, *staleRequests)
+	}
+}
+
+func TestCRLCacheEviction(t *testing.T) {
+	cache := NewCRLCache()
+	cache.MaxEntries = 2
+
+	var servers []*httptest.Server
+	for i := 0; i < 3; i++ {
+		server, _ := newCRLServer(t, time.Now().Add(time.Hour))
+		defer server.Close()
+		servers = append(servers, server)
+	}
+
+	for _, server := range servers {
+		if _, _, err := cache.Get(context.Background(), nil, server.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if cache.Len() != 2 {
+		t.Fatalf("expected 2 cached CRLs, got %d", cache.Len())
+	}
+	if _, ok := cache.Lookup(servers[0].URL); ok {
+		t.Fatal("the least recently used CRL should have been evicted")
+	}
+}
+
+func TestCRLCacheLimits(t *testing.T) {
+	server, _ := newCRLServer(t, time.Now().Add(time.Hour))
+	defer server.Close()
+
+	cache := NewCRLCache()
+	cache.MaxCRLSize = 16
+	if _, _, err := cache.Get(context.Background(), nil, server.URL); err == nil {
+		t.Fatal("a CRL larger than the size limit should be rejected")
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer slow.Close()
+
+	cache = NewCRLCache()
+	cache.Timeout = 10 * time.Millisecond
+	if _, _, err := cache.Get(context.Background(), nil, slow.URL); err == nil {
+		t.Fatal("a slow CRL distribution point should time out")
+	}
+}
+
+func TestCRLCachePersistence(t *testing.T) {
+	server, requests := newCRLServer(t, time.Now().Add(time.Hour))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "cfssl-crl-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := NewCRLCache()
+	cache.Dir = dir
+	if _, _, err = cache.Get(context.Background(), nil, server.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new cache reads the CRL back from disk.
+	cache = NewCRLCache()
+	cache.Dir = dir
+	if _, fromCache, err := cache.Get(context.Background(), nil, server.URL); err != nil {
+		t.Fatal(err)
+	} else if !fromCache {
+		t.Fatal("CRL should have been read from disk")
+	}
+	if *requests != 1 {
+		t.Fatalf("expected 1 fetch, got %d", *requests)
+	}
+
+	cache.Delete(server.URL)
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("deleted CRL is still on disk: %v", files)
+	}
+}
+
+func TestCRLCacheConcurrent(t *testing.T) {
+	server, _ := newCRLServer(t, time.Now().Add(time.Hour))
+	defer server.Close()
+
+	cache := NewCRLCache()
+	cache.MaxEntries = 1
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			url := server.URL
+			if i%2 == 1 {
+				url += "/other"
+			}
+			if _, _, err := cache.Get(context.Background(), nil, url); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
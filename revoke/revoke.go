@@ -1,19 +1,25 @@
 // Package revoke provides functionality for checking the validity of
 // a cert. Specifically, the temporal validity of the certificate is
-// checked first, then any CRL in the cert is checked. OCSP is not
-// supported at this time.
+// checked first, then the certificate's OCSP responders are queried,
+// and finally any CRL in the cert is checked. OCSP requires the
+// certificate's issuer: it is either supplied by the caller (as with
+// VerifyCertificateWithIssuer and VerifyChain) or fetched from the
+// certificate's AIA issuing certificate URL.
 package revoke
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"net/http"
 	neturl "net/url"
 	"time"
 
@@ -28,13 +34,35 @@ import (
 // verification to fail (a hard failure).
 var HardFail = false
 
-// TODO (kyle): figure out a good mechanism for OCSP; this requires
-// presenting both the certificate and the issuer, and we don't have a
-// good way at this time of getting the issuer.
+// CRLSet caches the CRLs used for revocation checks, keyed by the URL
+// each CRL is fetched from. It may be replaced, for instance with a
+// cache that persists CRLs to disk, before any checks are made.
+var CRLSet = NewCRLCache()
+
+// A Checker checks the revocation status of certificates. Its fields
+// may be left nil: the package-level functions use a zero Checker,
+// which fetches with helpers.DefaultFetcher and caches CRLs in CRLSet.
+type Checker struct {
+	// Fetcher retrieves CRLs, AIA issuer certificates and OCSP
+	// responses.
+	Fetcher helpers.Fetcher
+	// CRLs caches the CRLs the checker fetches.
+	CRLs *CRLCache
+}
 
-// CRLSet associates a PKIX certificate list with the URL the CRL is
-// fetched from.
-var CRLSet = map[string]*pkix.CertificateList{}
+func (c *Checker) fetcher() helpers.Fetcher {
+	if c.Fetcher == nil {
+		return helpers.DefaultFetcher
+	}
+	return c.Fetcher
+}
+
+func (c *Checker) crls() *CRLCache {
+	if c.CRLs == nil {
+		return CRLSet
+	}
+	return c.CRLs
+}
 
 // We can't handle LDAP certificates, so this checks to see if the
 // URL string points to an LDAP resource so that we can ignore it.
@@ -50,10 +78,79 @@ func ldapURL(url string) bool {
 	return false
 }
 
-// revCheck should check the certificate for any revocations. It
-// returns a pair of booleans: the first indicates whether the certificate
-// is revoked, the second indicates whether the revocations were
-// successfully checked.. This leads to the following combinations:
+// Method identifies how the revocation status of a certificate was
+// determined.
+type Method string
+
+// The methods by which a certificate's status is determined.
+const (
+	// MethodValidity means the certificate was rejected because it
+	// is outside its validity period.
+	MethodValidity Method = "validity"
+	// MethodOCSP means the status came from an OCSP responder.
+	MethodOCSP Method = "OCSP"
+	// MethodCRL means the status came from a CRL.
+	MethodCRL Method = "CRL"
+)
+
+// A Result describes the outcome of a revocation check. Revoked and
+// OK have the same meaning as the pair of booleans returned by
+// VerifyCertificate. The other fields record why: the method that
+// decided the status (empty if the certificate has neither OCSP
+// responders nor CRLs), the OCSP responder or CRL URL that was used,
+// the RFC 5280 reason code and time of a revocation, any error that
+// prevented a successful check, and whether the CRL came from CRLSet
+// rather than being fetched.
+type Result struct {
+	Revoked     bool
+	OK          bool
+	Method      Method
+	Expired     bool
+	NotYetValid bool
+	URL         string
+	Reason      int
+	RevokedAt   time.Time
+	Err         error
+	FromCache   bool
+}
+
+// String describes the result for logging.
+func (r Result) String() string {
+	switch {
+	case r.Expired:
+		return "certificate has expired"
+	case r.NotYetValid:
+		return "certificate is not yet valid"
+	case !r.OK && r.Err != nil:
+		return fmt.Sprintf("%s check failed: %v", r.Method, r.Err)
+	case !r.OK:
+		return "revocation check failed"
+	case r.Revoked:
+		msg := fmt.Sprintf("certificate revoked (reason %d) at %s via %s %s",
+			r.Reason, r.RevokedAt.Format(time.RFC3339), r.Method, r.URL)
+		if r.FromCache {
+			msg += " (cached)"
+		}
+		return msg
+	case r.Method == "":
+		return "certificate has no revocation information"
+	default:
+		return fmt.Sprintf("certificate not revoked according to %s %s", r.Method, r.URL)
+	}
+}
+
+// failed marks a result as an unsuccessful check, which counts as a
+// revocation under HardFail.
+func failed(r Result, err error) Result {
+	r.Revoked = HardFail
+	r.OK = false
+	r.Err = err
+	return r
+}
+
+// revCheck should check the certificate for any revocations. The
+// Revoked and OK fields of the result lead to the following
+// combinations:
 //
 //  false, false: an error was encountered while checking revocations.
 //
@@ -65,118 +162,232 @@ func ldapURL(url string) bool {
 //
 //  true, false:  failure to check revocation status causes
 //                  verification to fail
-func revCheck(cert *x509.Certificate) (revoked, ok bool) {
+//
+// OCSP is tried first, if the certificate names OCSP responders; if
+// the issuer is nil, it is fetched from the certificate's AIA. A
+// definitive OCSP answer is final; otherwise the CRLs are checked.
+func (c *Checker) revCheck(ctx context.Context, cert, issuer *x509.Certificate) Result {
+	var ocspResult *Result
+	if len(cert.OCSPServer) > 0 {
+		var result Result
+		if issuer == nil {
+			issuer = c.fetchIssuer(ctx, cert)
+		}
+
+		if issuer == nil {
+			result = failed(Result{Method: MethodOCSP}, errors.New("unable to fetch the issuer for OCSP"))
+		} else {
+			result = c.ocspCheck(ctx, cert, issuer)
+			if result.OK {
+				if result.Revoked {
+					log.Info("certificate is revoked via OCSP")
+				}
+				return result
+			}
+		}
+		log.Warning("error checking revocation via OCSP, falling back to CRL")
+		ocspResult = &result
+	}
+
+	var crlResult *Result
 	for _, url := range cert.CRLDistributionPoints {
 		if ldapURL(url) {
 			log.Infof("skipping LDAP CRL: %s", url)
 			continue
 		}
 
-		if revoked, ok := certIsRevokedCRL(cert, url); !ok {
+		result := c.crlCheck(ctx, cert, url)
+		if !result.OK {
 			log.Warning("error checking revocation via CRL")
-			if HardFail {
-				return true, false
-			}
-			return false, false
-		} else if revoked {
+			return result
+		} else if result.Revoked {
 			log.Info("certificate is revoked via CRL")
-			return true, true
-		}
-
-		if revoked, ok := certIsRevokedOCSP(cert, HardFail); !ok {
-			log.Warning("error checking revocation via OCSP")
-			if HardFail {
-				return true, false
-			}
-			return false, false
-		} else if revoked {
-			log.Info("certificate is revoked via OCSP")
-			return true, true
+			return result
 		}
+		crlResult = &result
 	}
 
-	return false, true
-}
-
-// fetchCRL fetches and parses a CRL.
-func fetchCRL(url string) (*pkix.CertificateList, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	} else if resp.StatusCode >= 300 {
-		return nil, errors.New("failed to retrieve CRL")
+	if crlResult != nil {
+		return *crlResult
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	// The OCSP failure stands if there was no CRL to fall back on.
+	if ocspResult != nil {
+		return *ocspResult
 	}
-	resp.Body.Close()
 
-	return x509.ParseCRL(body)
+	return Result{OK: true}
 }
 
-// check a cert against a specific CRL. Returns the same bool pair
-// as revCheck.
-func certIsRevokedCRL(cert *x509.Certificate, url string) (revoked, ok bool) {
-	crl, ok := CRLSet[url]
-	if ok && crl == nil {
-		ok = false
-		delete(CRLSet, url)
-	}
-
-	var shouldFetchCRL = true
-	if ok {
-		if !crl.HasExpired(time.Now()) {
-			shouldFetchCRL = false
+// oidCRLReason is the OID of the CRL entry reason code extension.
+var oidCRLReason = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// crlEntryReason returns the reason code of a CRL entry, or 0
+// (unspecified) if it has none.
+func crlEntryReason(entry pkix.RevokedCertificate) int {
+	for _, ext := range entry.Extensions {
+		if ext.Id.Equal(oidCRLReason) {
+			var reason asn1.Enumerated
+			if _, err := asn1.Unmarshal(ext.Value, &reason); err == nil {
+				return int(reason)
+			}
 		}
 	}
+	return 0
+}
 
-	if shouldFetchCRL {
-		var err error
-		crl, err = fetchCRL(url)
-		if err != nil {
-			log.Warningf("failed to fetch CRL: %v", err)
-			return false, false
-		}
-		CRLSet[url] = crl
+// crlCheck checks a certificate against a specific CRL.
+func (c *Checker) crlCheck(ctx context.Context, cert *x509.Certificate, url string) Result {
+	result := Result{Method: MethodCRL, URL: url}
+
+	crl, fromCache, err := c.crls().Get(ctx, c.fetcher(), url)
+	if err != nil {
+		log.Warningf("failed to fetch CRL: %v", err)
+		return failed(result, err)
 	}
+	result.FromCache = fromCache
 
+	result.OK = true
 	for _, revoked := range crl.TBSCertList.RevokedCertificates {
 		if cert.SerialNumber.Cmp(revoked.SerialNumber) == 0 {
 			log.Info("Serial number match: intermediate is revoked.")
-			return true, true
+			result.Revoked = true
+			result.Reason = crlEntryReason(revoked)
+			result.RevokedAt = revoked.RevocationTime
+			return result
 		}
 	}
 
-	return false, true
+	return result
 }
 
-// VerifyCertificate ensures that the certificate passed in hasn't
-// expired and checks the CRL for the server.
-func VerifyCertificate(cert *x509.Certificate) (revoked, ok bool) {
+// checkValidity checks whether the certificate is outside its
+// validity period, in which case it is treated as revoked.
+func checkValidity(cert *x509.Certificate) (result Result, invalid bool) {
 	if !time.Now().Before(cert.NotAfter) {
 		log.Infof("Certificate expired %s\n", cert.NotAfter)
-		return true, true
+		return Result{Revoked: true, OK: true, Method: MethodValidity, Expired: true}, true
 	} else if !time.Now().After(cert.NotBefore) {
 		log.Infof("Certificate isn't valid until %s\n", cert.NotBefore)
-		return true, true
+		return Result{Revoked: true, OK: true, Method: MethodValidity, NotYetValid: true}, true
 	}
+	return Result{}, false
+}
 
-	return revCheck(cert)
+// VerifyCertificate ensures that the certificate passed in hasn't
+// expired and checks its revocation status via OCSP, if the issuer
+// can be fetched from the certificate's AIA, and then the CRL.
+func VerifyCertificate(cert *x509.Certificate) (revoked, ok bool) {
+	result := Check(cert)
+	return result.Revoked, result.OK
 }
 
-func fetchRemote(url string) (*x509.Certificate, error) {
-	resp, err := http.Get(url)
+// VerifyCertificateWithIssuer is like VerifyCertificate, but uses
+// the given issuer for OCSP rather than fetching it. The OCSP
+// response must be signed by the issuer or by a responder certificate
+// that the issuer delegated OCSP signing to. If OCSP gives no
+// definitive answer, the certificate's CRLs are checked.
+func VerifyCertificateWithIssuer(cert, issuer *x509.Certificate) (revoked, ok bool) {
+	result := CheckWithIssuer(cert, issuer)
+	return result.Revoked, result.OK
+}
+
+// VerifyChain checks every certificate in a chain, ordered from the
+// leaf towards the root, using the next certificate in the chain as
+// the issuer of each one. A self-signed certificate at the end of the
+// chain is only checked for validity. The chain is revoked if any of
+// its certificates is, and checked successfully only if all of them
+// are.
+func VerifyChain(chain []*x509.Certificate) (revoked, ok bool) {
+	result := CheckChain(chain)
+	return result.Revoked, result.OK
+}
+
+// Check is like VerifyCertificate, but returns a Result describing
+// how the status was determined.
+func Check(cert *x509.Certificate) Result {
+	return new(Checker).Check(context.Background(), cert)
+}
+
+// CheckWithIssuer is like VerifyCertificateWithIssuer, but returns a
+// Result describing how the status was determined.
+func CheckWithIssuer(cert, issuer *x509.Certificate) Result {
+	return new(Checker).CheckWithIssuer(context.Background(), cert, issuer)
+}
+
+// CheckChain is like VerifyChain, but returns a Result describing
+// how the status was determined: that of the first revoked
+// certificate, else that of the first certificate that couldn't be
+// checked, else that of the leaf.
+func CheckChain(chain []*x509.Certificate) Result {
+	return new(Checker).CheckChain(context.Background(), chain)
+}
+
+// Check checks a certificate as VerifyCertificate does. Network
+// requests are made with ctx.
+func (c *Checker) Check(ctx context.Context, cert *x509.Certificate) Result {
+	return c.CheckWithIssuer(ctx, cert, nil)
+}
+
+// CheckWithIssuer checks a certificate as VerifyCertificateWithIssuer
+// does. Network requests are made with ctx.
+func (c *Checker) CheckWithIssuer(ctx context.Context, cert, issuer *x509.Certificate) Result {
+	if result, invalid := checkValidity(cert); invalid {
+		return result
+	}
+
+	return c.revCheck(ctx, cert, issuer)
+}
+
+// CheckChain checks a chain as VerifyChain does, returning a Result
+// as the package-level CheckChain does. Network requests are made
+// with ctx.
+func (c *Checker) CheckChain(ctx context.Context, chain []*x509.Certificate) Result {
+	var first, failure *Result
+	for i, cert := range chain {
+		var result Result
+		if i+1 < len(chain) {
+			result = c.CheckWithIssuer(ctx, cert, chain[i+1])
+		} else if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			var invalid bool
+			if result, invalid = checkValidity(cert); !invalid {
+				result = Result{OK: true}
+			}
+		} else {
+			result = c.CheckWithIssuer(ctx, cert, nil)
+		}
+
+		if result.Revoked {
+			return result
+		}
+		if !result.OK && failure == nil {
+			failure = &result
+		}
+		if first == nil {
+			first = &result
+		}
+	}
+
+	if failure != nil {
+		return *failure
+	}
+	if first != nil {
+		return *first
+	}
+	return Result{OK: true}
+}
+
+func (c *Checker) fetchRemote(ctx context.Context, url string) (*x509.Certificate, error) {
+	body, err := c.fetcher().Get(ctx, url)
 	if err != nil {
 		return nil, err
 	}
 
-	in, err := ioutil.ReadAll(resp.Body)
+	in, err := ioutil.ReadAll(body)
+	body.Close()
 	if err != nil {
 		return nil, err
 	}
-	resp.Body.Close()
 
 	p, _ := pem.Decode(in)
 	if p != nil {
@@ -190,92 +401,134 @@ var ocspOpts = ocsp.RequestOptions{
 	Hash: crypto.SHA1,
 }
 
-func certIsRevokedOCSP(leaf *x509.Certificate, strict bool) (revoked, ok bool) {
-	var err error
-
-	ocspURLs := leaf.OCSPServer
-	if len(ocspURLs) == 0 {
-		// OCSP not enabled for this certificate.
-		return false, true
-	}
-
-	var issuer *x509.Certificate
+// fetchIssuer fetches the issuer of a certificate from its AIA
+// issuing certificate URLs, returning nil if none can be fetched.
+func (c *Checker) fetchIssuer(ctx context.Context, leaf *x509.Certificate) *x509.Certificate {
 	for _, issuingCert := range leaf.IssuingCertificateURL {
-		issuer, err = fetchRemote(issuingCert)
+		issuer, err := c.fetchRemote(ctx, issuingCert)
 		if err != nil {
+			log.Warningf("failed to fetch issuer from %s: %v", issuingCert, err)
 			continue
 		}
-		break
+		return issuer
 	}
+	return nil
+}
 
-	if issuer == nil {
-		return
+// ocspCheck queries the certificate's OCSP responders using a known
+// issuer, in turn until one answers. Only a validly signed, current
+// response of good or revoked for this certificate counts as a
+// successful check.
+func (c *Checker) ocspCheck(ctx context.Context, leaf, issuer *x509.Certificate) Result {
+	result := Result{Method: MethodOCSP}
+
+	ocspURLs := leaf.OCSPServer
+	if len(ocspURLs) == 0 {
+		// OCSP not enabled for this certificate.
+		result.OK = true
+		return result
 	}
 
 	ocspRequest, err := ocsp.CreateRequest(leaf, issuer, &ocspOpts)
 	if err != nil {
-		return
+		return failed(result, err)
 	}
 
 	for _, server := range ocspURLs {
-		resp, err := sendOCSPRequest(server, ocspRequest, issuer)
+		result.URL = server
+		resp, err := c.sendOCSPRequest(ctx, server, ocspRequest, leaf, issuer)
+		if err == nil && resp.Status == ocsp.Unknown {
+			err = errors.New("OCSP responder does not know the certificate")
+		}
 		if err != nil {
-			if strict {
-				return
-			}
+			log.Warningf("OCSP check against %s failed: %v", server, err)
+			result = failed(result, err)
 			continue
 		}
 
-		// There wasn't an error fetching the OCSP status.
-		ok = true
+		result = Result{Method: MethodOCSP, URL: server, OK: true}
+		if resp.Status == ocsp.Revoked {
+			result.Revoked = true
+			result.Reason = resp.RevocationReason
+			result.RevokedAt = resp.RevokedAt
+		}
+		return result
+	}
+	return result
+}
 
-		if resp.Status != ocsp.Good {
-			// The certificate was revoked.
-			revoked = true
+// checkOCSPResponse verifies that a response signed by a delegated
+// responder was delegated OCSP signing by the issuer, and that the
+// response is for the certificate and still current. The signature
+// itself is checked by ocsp.ParseResponse.
+func checkOCSPResponse(resp *ocsp.Response, leaf, issuer *x509.Certificate) error {
+	if resp.Certificate != nil && !resp.Certificate.Equal(issuer) {
+		delegated := false
+		for _, eku := range resp.Certificate.ExtKeyUsage {
+			if eku == x509.ExtKeyUsageOCSPSigning {
+				delegated = true
+				break
+			}
+		}
+		if !delegated {
+			return errors.New("OCSP responder certificate is not authorised for OCSP signing")
 		}
+	}
+
+	if resp.SerialNumber == nil || resp.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		return errors.New("OCSP response is for a different certificate")
+	}
 
-		return
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(time.Now()) {
+		return errors.New("OCSP response has expired")
 	}
-	return
+
+	return nil
 }
 
 var ocspUnauthorised = []byte{0x30, 0x03, 0x0a, 0x01, 0x06}
 var ocspMalformed = []byte{0x30, 0x03, 0x0a, 0x01, 0x01}
 
 // sendOCSPRequest attempts to request an OCSP response from the
-// server. The error only indicates a failure to *fetch* the
-// certificate, and *does not* mean the certificate is valid.
-func sendOCSPRequest(server string, req []byte, issuer *x509.Certificate) (ocspResponse *ocsp.Response, err error) {
-	var resp *http.Response
+// server. The error only indicates a failure to *fetch* or verify the
+// response, and *does not* mean the certificate is valid.
+func (c *Checker) sendOCSPRequest(ctx context.Context, server string, req []byte, leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	var resp io.ReadCloser
+	var err error
 	if len(req) > 256 {
 		buf := bytes.NewBuffer(req)
-		resp, err = http.Post(server, "application/ocsp-request", buf)
+		resp, err = c.fetcher().Post(ctx, server, "application/ocsp-request", buf)
 	} else {
-		reqURL := server + "/" + base64.StdEncoding.EncodeToString(req)
-		resp, err = http.Get(reqURL)
+		reqURL := server + "/" + neturl.QueryEscape(base64.StdEncoding.EncodeToString(req))
+		resp, err = c.fetcher().Get(ctx, reqURL)
 	}
 
 	if err != nil {
-		return
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return
+		return nil, err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(resp)
+	resp.Close()
 	if err != nil {
-		return
+		return nil, err
 	}
-	resp.Body.Close()
 
 	if bytes.Equal(body, ocspUnauthorised) {
-		return
+		return nil, errors.New("OCSP unauthorized")
 	}
 
 	if bytes.Equal(body, ocspMalformed) {
-		return
+		return nil, errors.New("OCSP malformed")
+	}
+
+	ocspResponse, err := ocsp.ParseResponse(body, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkOCSPResponse(ocspResponse, leaf, issuer); err != nil {
+		return nil, err
 	}
 
-	return ocsp.ParseResponse(body, issuer)
+	return ocspResponse, nil
 }
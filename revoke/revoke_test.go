@@ -1,13 +1,29 @@
 package revoke
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
-	//"crypto/x509/pkix"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/ocsp"
 )
 
 // The first three test cases represent known revoked, expired, and good
@@ -48,7 +64,9 @@ sESPRwHkcMUNdAp37FLweUw=
 -----END CERTIFICATE-----`)
 
 // 2014/05/22 14:18:31 Serial number match: intermediate is revoked.
+//
 //	2014/05/22 14:18:31 certificate is revoked via CRL
+//
 // 2014/05/22 14:18:31 Revoked certificate: misc/intermediate_ca/MobileArmorEnterpriseCA.crt
 var revokedCert = mustParse(`-----BEGIN CERTIFICATE-----
 MIIEEzCCAvugAwIBAgILBAAAAAABGMGjftYwDQYJKoZIhvcNAQEFBQAwcTEoMCYG
@@ -185,12 +203,12 @@ func TestCRLFetchError(t *testing.T) {
 func TestBadCRLSet(t *testing.T) {
 	ldapCert := mustParse(goodstring)
 	ldapCert.CRLDistributionPoints[0] = ""
-	CRLSet[""] = nil
-	certIsRevokedCRL(ldapCert, "")
-	if _, ok := CRLSet[""]; ok {
+	CRLSet.Set("", nil)
+	new(Checker).crlCheck(context.Background(), ldapCert, "")
+	if _, ok := CRLSet.Lookup(""); ok {
 		t.Fatalf("key emptystring should be deleted from CRLSet")
 	}
-	delete(CRLSet, "")
+	CRLSet.Delete("")
 
 }
 
@@ -205,7 +223,7 @@ func TestRemoteFetchError(t *testing.T) {
 
 	badurl := ":"
 
-	if _, err := fetchRemote(badurl); err == nil {
+	if _, err := new(Checker).fetchRemote(context.Background(), badurl); err == nil {
 		t.Fatalf("fetching bad url should result in non-nil error")
 	}
 
@@ -214,10 +232,334 @@ func TestRemoteFetchError(t *testing.T) {
 func TestNoOCSPServers(t *testing.T) {
 	badIssuer := goodCert
 	badIssuer.IssuingCertificateURL = []string{" "}
-	certIsRevokedOCSP(badIssuer, true)
+	c := new(Checker)
+	if issuer := c.fetchIssuer(context.Background(), badIssuer); issuer != nil {
+		t.Fatalf("issuer fetched from a bad AIA URL")
+	}
 	noOCSPCert := goodCert
 	noOCSPCert.OCSPServer = make([]string, 0)
-	if revoked, ok := certIsRevokedOCSP(noOCSPCert, true); revoked || !ok {
+	if result := c.ocspCheck(context.Background(), noOCSPCert, nil); result.Revoked || !result.OK {
 		t.Fatalf("OCSP falsely registered as enabled for this certificate")
 	}
 }
+
+// testPKI is a CA with a leaf certificate whose OCSP responder is a
+// test server answering with the configured status, signed by the
+// configured responder.
+type testPKI struct {
+	ca, leaf     *x509.Certificate
+	responder    *x509.Certificate
+	responderKey crypto.Signer
+	status       int
+	server       *httptest.Server
+}
+
+func newTestCert(t *testing.T, template, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	pki := &testPKI{status: ocsp.Good}
+	pki.server = httptest.NewServer(http.HandlerFunc(pki.serveOCSP))
+
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca, caKey := newTestCert(t, caTemplate, nil, nil)
+	pki.ca, pki.responder, pki.responderKey = ca, ca, caKey
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		OCSPServer:   []string{pki.server.URL},
+	}
+	pki.leaf, _ = newTestCert(t, leafTemplate, ca, caKey)
+	return pki
+}
+
+// delegate makes the test server sign responses with a new responder
+// certificate issued by the CA, with or without the OCSP signing EKU.
+func (pki *testPKI) delegate(t *testing.T, caKey crypto.Signer, ocspSigning bool) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "Test OCSP Responder"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if ocspSigning {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}
+	}
+	pki.responder, pki.responderKey = newTestCert(t, template, pki.ca, caKey)
+}
+
+func (pki *testPKI) serveOCSP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	var err error
+	if r.Method == "POST" {
+		body, err = ioutil.ReadAll(r.Body)
+	} else {
+		body, err = base64.StdEncoding.DecodeString(r.URL.Path[1:])
+	}
+	if err != nil {
+		w.Write(ocspMalformed)
+		return
+	}
+
+	req, err := ocsp.ParseRequest(body)
+	if err != nil {
+		w.Write(ocspMalformed)
+		return
+	}
+
+	template := ocsp.Response{
+		Status:       pki.status,
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}
+	if pki.responder != pki.ca {
+		template.Certificate = pki.responder
+	}
+
+	resp, err := ocsp.CreateResponse(pki.ca, pki.responder, template, pki.responderKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(resp)
+}
+
+func TestVerifyCertificateWithIssuerOCSP(t *testing.T) {
+	pki := newTestPKI(t)
+	defer pki.server.Close()
+
+	if revoked, ok := VerifyCertificateWithIssuer(pki.leaf, pki.ca); revoked || !ok {
+		t.Fatalf("good certificate: revoked=%v, ok=%v", revoked, ok)
+	}
+
+	pki.status = ocsp.Revoked
+	if revoked, ok := VerifyCertificateWithIssuer(pki.leaf, pki.ca); !revoked || !ok {
+		t.Fatalf("revoked certificate: revoked=%v, ok=%v", revoked, ok)
+	}
+
+	// An unknown status is not a successful check, and there is no
+	// CRL to fall back on.
+	pki.status = ocsp.Unknown
+	if _, ok := VerifyCertificateWithIssuer(pki.leaf, pki.ca); ok {
+		t.Fatal("unknown status should not be a successful check")
+	}
+}
+
+func TestVerifyCertificateWithIssuerDelegatedResponder(t *testing.T) {
+	pki := newTestPKI(t)
+	defer pki.server.Close()
+	caKey := pki.responderKey
+
+	pki.delegate(t, caKey, true)
+	pki.status = ocsp.Revoked
+	if revoked, ok := VerifyCertificateWithIssuer(pki.leaf, pki.ca); !revoked || !ok {
+		t.Fatalf("delegated responder: revoked=%v, ok=%v", revoked, ok)
+	}
+
+	pki.delegate(t, caKey, false)
+	if _, ok := VerifyCertificateWithIssuer(pki.leaf, pki.ca); ok {
+		t.Fatal("accepted a response from a responder without the OCSP signing EKU")
+	}
+}
+
+func TestVerifyCertificateWithWrongIssuer(t *testing.T) {
+	pki := newTestPKI(t)
+	defer pki.server.Close()
+
+	other := newTestPKI(t)
+	defer other.server.Close()
+
+	if _, ok := VerifyCertificateWithIssuer(pki.leaf, other.ca); ok {
+		t.Fatal("accepted an OCSP response that doesn't verify against the issuer")
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	pki := newTestPKI(t)
+	defer pki.server.Close()
+
+	chain := []*x509.Certificate{pki.leaf, pki.ca}
+	if revoked, ok := VerifyChain(chain); revoked || !ok {
+		t.Fatalf("good chain: revoked=%v, ok=%v", revoked, ok)
+	}
+
+	pki.status = ocsp.Revoked
+	if revoked, ok := VerifyChain(chain); !revoked || !ok {
+		t.Fatalf("chain with revoked leaf: revoked=%v, ok=%v", revoked, ok)
+	}
+}
+
+func TestCheckWithIssuerOCSPResult(t *testing.T) {
+	pki := newTestPKI(t)
+	defer pki.server.Close()
+
+	result := CheckWithIssuer(pki.leaf, pki.ca)
+	if result.Revoked || !result.OK || result.Method != MethodOCSP || result.URL != pki.server.URL {
+		t.Fatalf("good certificate: %+v", result)
+	}
+
+	pki.status = ocsp.Revoked
+	result = CheckWithIssuer(pki.leaf, pki.ca)
+	if !result.Revoked || !result.OK || result.Method != MethodOCSP {
+		t.Fatalf("revoked certificate: %+v", result)
+	}
+	if result.RevokedAt.IsZero() || result.Err != nil || result.FromCache {
+		t.Fatalf("revoked certificate: %+v", result)
+	}
+
+	pki.status = ocsp.Unknown
+	result = CheckWithIssuer(pki.leaf, pki.ca)
+	if result.OK || result.Err == nil || result.Method != MethodOCSP {
+		t.Fatalf("unknown status: %+v", result)
+	}
+}
+
+func TestCheckCRLResult(t *testing.T) {
+	pki := newTestPKI(t)
+	defer pki.server.Close()
+	caKey := pki.responderKey
+
+	reason, err := asn1.Marshal(asn1.Enumerated(ocsp.KeyCompromise))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedAt := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	crl, err := pki.ca.CreateCRL(rand.Reader, caKey, []pkix.RevokedCertificate{{
+		SerialNumber:   big.NewInt(4),
+		RevocationTime: revokedAt,
+		Extensions:     []pkix.Extension{{Id: oidCRLReason, Value: reason}},
+	}}, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(crl)
+	}))
+	defer crlServer.Close()
+	defer CRLSet.Delete(crlServer.URL)
+
+	cert, _ := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(4),
+		Subject:               pkix.Name{CommonName: "crl.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		CRLDistributionPoints: []string{crlServer.URL},
+	}, pki.ca, caKey)
+
+	result := Check(cert)
+	if !result.Revoked || !result.OK || result.Method != MethodCRL || result.URL != crlServer.URL {
+		t.Fatalf("revoked certificate: %+v", result)
+	}
+	if result.Reason != ocsp.KeyCompromise || !result.RevokedAt.Equal(revokedAt) || result.FromCache {
+		t.Fatalf("revoked certificate: %+v", result)
+	}
+
+	result = Check(cert)
+	if !result.Revoked || !result.FromCache {
+		t.Fatalf("CRL should have been read from the cache: %+v", result)
+	}
+}
+
+func TestCheckExpiredResult(t *testing.T) {
+	cert, _ := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "expired.example.com"},
+		NotBefore:    time.Now().Add(-2 * time.Hour),
+		NotAfter:     time.Now().Add(-time.Hour),
+	}, nil, nil)
+
+	result := Check(cert)
+	if !result.Revoked || !result.OK || !result.Expired || result.Method != MethodValidity {
+		t.Fatalf("expired certificate: %+v", result)
+	}
+}
+
+// memFetcher is an in-process stand-in for the network, answering GET
+// requests from a map of URLs to bodies.
+type memFetcher map[string][]byte
+
+func (f memFetcher) Get(ctx context.Context, url string) (io.ReadCloser, error) {
+	body, ok := f[url]
+	if !ok {
+		return nil, errors.New("not found: " + url)
+	}
+	return ioutil.NopCloser(bytes.NewReader(body)), nil
+}
+
+func (f memFetcher) Post(ctx context.Context, url, contentType string, body io.Reader) (io.ReadCloser, error) {
+	return nil, errors.New("POST not supported")
+}
+
+func TestCheckerFetcher(t *testing.T) {
+	ca, caKey := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+
+	crl, err := ca.CreateCRL(rand.Reader, caKey, []pkix.RevokedCertificate{{
+		SerialNumber:   big.NewInt(2),
+		RevocationTime: time.Now().Add(-time.Minute),
+	}}, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const crlURL = "http://crl.example.com/ca.crl"
+	cert, _ := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "leaf.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		CRLDistributionPoints: []string{crlURL},
+	}, ca, caKey)
+
+	checker := &Checker{Fetcher: memFetcher{crlURL: crl}, CRLs: NewCRLCache()}
+	result := checker.Check(context.Background(), cert)
+	if !result.Revoked || !result.OK || result.Method != MethodCRL {
+		t.Fatalf("revoked certificate: %+v", result)
+	}
+	if _, ok := CRLSet.Lookup(crlURL); ok {
+		t.Fatal("checker should not use the package CRL cache")
+	}
+
+	checker = &Checker{Fetcher: memFetcher{}, CRLs: NewCRLCache()}
+	if result = checker.Check(context.Background(), cert); result.OK || result.Err == nil {
+		t.Fatalf("unreachable CRL: %+v", result)
+	}
+}
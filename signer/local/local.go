@@ -2,16 +2,27 @@
 package local
 
 import (
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/crl"
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/ct"
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
@@ -21,12 +32,23 @@ import (
 // Signer contains a signer that uses the standard library to
 // support both ECDSA and RSA CA keys.
 type Signer struct {
-	ca      *x509.Certificate
-	priv    crypto.Signer
-	policy  *config.Signing
-	sigAlgo x509.SignatureAlgorithm
+	ca         *x509.Certificate
+	priv       crypto.Signer
+	policy     *config.Signing
+	sigAlgo    x509.SignatureAlgorithm
+	dbAccessor certdb.Accessor
+	serialGen  signer.SerialGenerator
+	ctFetcher  helpers.Fetcher
+	label      string
 }
 
+// ctSubmitTimeout bounds each precertificate submission to a CT log.
+const ctSubmitTimeout = 30 * time.Second
+
+// maxSerialAttempts is the number of serial numbers drawn before
+// giving up on finding one that isn't in the certificate store.
+const maxSerialAttempts = 8
+
 // NewSigner creates a new Signer directly from a
 // private key and certificate, with optional policy.
 func NewSigner(priv crypto.Signer, cert *x509.Certificate, sigAlgo x509.SignatureAlgorithm, policy *config.Signing) (*Signer, error) {
@@ -76,7 +98,12 @@ func NewSignerFromFile(caFile, caKeyFile string, policy *config.Signing) (*Signe
 	return NewSigner(priv, parsedCa, signer.DefaultSigAlgo(priv), policy)
 }
 
-func (s *Signer) sign(template *x509.Certificate, profile *config.SigningProfile, serialSeq string) (cert []byte, err error) {
+func (s *Signer) sign(template *x509.Certificate, profile *config.SigningProfile, label, serialSeq string) (cert []byte, err error) {
+	template.SerialNumber, err = s.serial(profile, serialSeq)
+	if err != nil {
+		return
+	}
+
 	err = signer.FillTemplate(template, s.policy.Default, profile, serialSeq)
 	if err != nil {
 		return
@@ -97,6 +124,15 @@ func (s *Signer) sign(template *x509.Certificate, profile *config.SigningProfile
 		template.MaxPathLen = 1
 		template.DNSNames = nil
 	}
+	if err = s.expandURLs(template, label); err != nil {
+		return nil, err
+	}
+
+	if len(profile.CTLogServers) > 0 && !initRoot {
+		if err = s.embedSCTs(template, profile); err != nil {
+			return nil, err
+		}
+	}
 
 	derBytes, err := x509.CreateCertificate(rand.Reader, template, s.ca, template.PublicKey, s.priv)
 	if err != nil {
@@ -114,6 +150,121 @@ func (s *Signer) sign(template *x509.Certificate, profile *config.SigningProfile
 	return
 }
 
+// expandURLs fills in the variables in the template's issuer, OCSP and
+// CRL URLs with the signer's label and the details of its CA. A signer
+// with no label of its own uses the label of the request, and a URL
+// that needs a label fails if neither has one.
+func (s *Signer) expandURLs(template *x509.Certificate, label string) error {
+	if s.label != "" {
+		label = s.label
+	}
+	vars := map[string]string{
+		config.LabelURLVar:        label,
+		config.IssuerSKIURLVar:    hex.EncodeToString(s.ca.SubjectKeyId),
+		config.IssuerSerialURLVar: s.ca.SerialNumber.String(),
+	}
+	expand := func(urls []string) []string {
+		if urls == nil {
+			return nil
+		}
+		// The URLs may be shared with the profile, so they are
+		// copied rather than expanded in place.
+		expanded := make([]string, len(urls))
+		for i, u := range urls {
+			expanded[i] = config.ExpandURL(u, vars)
+		}
+		return expanded
+	}
+
+	if label == "" {
+		labelVar := "{" + config.LabelURLVar + "}"
+		urls := append(append(append([]string{}, template.IssuingCertificateURL...),
+			template.OCSPServer...), template.CRLDistributionPoints...)
+		for _, u := range urls {
+			if strings.Contains(u, labelVar) {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest,
+					fmt.Errorf("URL %s needs a label, but neither the signer nor the request has one", u))
+			}
+		}
+	}
+
+	template.IssuingCertificateURL = expand(template.IssuingCertificateURL)
+	template.OCSPServer = expand(template.OCSPServer)
+	template.CRLDistributionPoints = expand(template.CRLDistributionPoints)
+	return nil
+}
+
+// embedSCTs issues a precertificate for template, submits it to each
+// of the profile's CT logs and adds the SCTs they return to template.
+func (s *Signer) embedSCTs(template *x509.Certificate, profile *config.SigningProfile) error {
+	if len(profile.CTLogPublicKeys) != len(profile.CTLogServers) {
+		return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+			errors.New("the profile needs a public key for each CT log"))
+	}
+
+	extensions := template.ExtraExtensions
+	template.ExtraExtensions = append(extensions[:len(extensions):len(extensions)], ct.PoisonExtension())
+	precert, err := x509.CreateCertificate(rand.Reader, template, s.ca, template.PublicKey, s.priv)
+	template.ExtraExtensions = extensions
+	if err != nil {
+		return cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+
+	chain := [][]byte{precert, s.ca.Raw}
+	var scts []*ct.SignedCertificateTimestamp
+	for i, server := range profile.CTLogServers {
+		log.Debugf("submitting precertificate to CT log %s", server)
+		ctx, cancel := context.WithTimeout(context.Background(), ctSubmitTimeout)
+		client := &ct.Client{URL: server, PublicKey: profile.CTLogPublicKeys[i], Fetcher: s.ctFetcher}
+		sct, err := client.AddPreChain(ctx, chain)
+		cancel()
+		if err != nil {
+			return cferr.Wrap(cferr.CTError, cferr.PrecertSubmitFailed,
+				fmt.Errorf("%s: %v", server, err))
+		}
+		scts = append(scts, sct)
+	}
+
+	ext, err := ct.SCTListExtension(scts)
+	if err != nil {
+		return cferr.Wrap(cferr.CTError, cferr.Unknown, err)
+	}
+	template.ExtraExtensions = append(extensions[:len(extensions):len(extensions)], ext)
+	return nil
+}
+
+// serial draws a serial number for a certificate signed under profile.
+// When the signer has a certificate store, serial numbers already
+// recorded for this CA are drawn again.
+func (s *Signer) serial(profile *config.SigningProfile, serialSeq string) (*big.Int, error) {
+	gen := s.serialGen
+	if gen == nil {
+		gen = &signer.RandomSerialGenerator{Length: profile.SerialLength}
+	}
+
+	for i := 0; i < maxSerialAttempts; i++ {
+		serial, err := gen.Serial(serialSeq)
+		if err != nil {
+			return nil, err
+		}
+		if s.dbAccessor == nil || s.ca == nil {
+			return serial, nil
+		}
+
+		records, err := s.dbAccessor.GetCertificate(serial.String(), hex.EncodeToString(s.ca.SubjectKeyId))
+		if err != nil {
+			return nil, cferr.Wrap(cferr.CertStoreError, cferr.Unknown, err)
+		}
+		if len(records) == 0 {
+			return serial, nil
+		}
+		log.Warningf("serial number %s is already in use, drawing another", serial)
+	}
+
+	return nil, cferr.Wrap(cferr.CertificateError, cferr.DuplicateSerial,
+		fmt.Errorf("no unused serial number after %d attempts", maxSerialAttempts))
+}
+
 // replaceSliceIfEmpty replaces the contents of replaced with newContents if
 // the slice referenced by replaced is empty
 func replaceSliceIfEmpty(replaced, newContents *[]string) {
@@ -142,26 +293,32 @@ func PopulateSubjectFromCSR(s *signer.Subject, req pkix.Name) pkix.Name {
 	replaceSliceIfEmpty(&name.Locality, &req.Locality)
 	replaceSliceIfEmpty(&name.Organization, &req.Organization)
 	replaceSliceIfEmpty(&name.OrganizationalUnit, &req.OrganizationalUnit)
+	replaceSliceIfEmpty(&name.StreetAddress, &req.StreetAddress)
+	replaceSliceIfEmpty(&name.PostalCode, &req.PostalCode)
+
+	if name.SerialNumber == "" {
+		name.SerialNumber = req.SerialNumber
+	}
+	if len(name.ExtraNames) == 0 {
+		name.ExtraNames = req.ExtraNames
+	}
 
 	return name
 }
 
-// OverrideHosts fills template's IPAddresses and DNSNames with the
-// content of hosts, if it is not nil.
+// OverrideHosts fills template's IPAddresses, EmailAddresses, URIs and
+// DNSNames with the content of hosts, if it is not nil. Hosts are
+// classified as csr.ParseHosts does.
 func OverrideHosts(template *x509.Certificate, hosts []string) {
-	if hosts != nil {
-		template.IPAddresses = []net.IP{}
-		template.DNSNames = []string{}
-	}
-
-	for i := range hosts {
-		if ip := net.ParseIP(hosts[i]); ip != nil {
-			template.IPAddresses = append(template.IPAddresses, ip)
-		} else {
-			template.DNSNames = append(template.DNSNames, hosts[i])
-		}
+	if hosts == nil {
+		return
 	}
 
+	sans := csr.ParseHosts(hosts)
+	template.IPAddresses = append([]net.IP{}, sans.IPAddresses...)
+	template.EmailAddresses = append([]string{}, sans.EmailAddresses...)
+	template.URIs = append([]*url.URL{}, sans.URIs...)
+	template.DNSNames = append([]string{}, sans.DNSNames...)
 }
 
 // Sign signs a new certificate based on the PEM-encoded client
@@ -193,6 +350,10 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 		return nil, err
 	}
 
+	if err = checkKeyPolicy(csrTemplate.PublicKey, profile); err != nil {
+		return nil, err
+	}
+
 	// Copy out only the fields from the CSR authorized by policy.
 	safeTemplate := x509.Certificate{}
 	// If the profile contains no explicit whitelist, assume that all fields
@@ -218,12 +379,176 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 		if profile.CSRWhitelist.IPAddresses {
 			safeTemplate.IPAddresses = csrTemplate.IPAddresses
 		}
+		if profile.CSRWhitelist.EmailAddresses {
+			safeTemplate.EmailAddresses = csrTemplate.EmailAddresses
+		}
+		if profile.CSRWhitelist.URIs {
+			safeTemplate.URIs = csrTemplate.URIs
+		}
+	}
+
+	if profile.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+		caKeyAlgo := config.KeyAlgorithm(s.priv.Public())
+		if sigAlgoKeyAlgorithm(profile.SignatureAlgorithm) != caKeyAlgo {
+			return nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+				fmt.Errorf("signature algorithm %s cannot be used with the CA's %s key",
+					helpers.SignatureString(profile.SignatureAlgorithm), caKeyAlgo))
+		}
+		safeTemplate.SignatureAlgorithm = profile.SignatureAlgorithm
 	}
 
 	OverrideHosts(&safeTemplate, req.Hosts)
 	safeTemplate.Subject = PopulateSubjectFromCSR(req.Subject, safeTemplate.Subject)
 
-	return s.sign(&safeTemplate, profile, serialSeq)
+	if err = checkAllowedNames(&safeTemplate, profile.AllowedNames); err != nil {
+		return nil, err
+	}
+
+	cert, err = s.sign(&safeTemplate, profile, req.Label, serialSeq)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.dbAccessor != nil {
+		err = s.recordCertificate(cert, req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cert, nil
+}
+
+// checkAllowedNames verifies that every DNS name and IP address in
+// the template, as well as its common name, is permitted by the
+// profile's allowed names. A common name must be an allowed IP address
+// if it parses as one, and an allowed DNS name otherwise. The domain of
+// an email address and the host of a URI must be allowed DNS names. A
+// nil AllowedNames permits any name.
+func checkAllowedNames(template *x509.Certificate, allowed *config.AllowedNames) error {
+	if allowed == nil {
+		return nil
+	}
+
+	for _, name := range template.DNSNames {
+		if !allowed.PermitsDNSName(name) {
+			return cferr.Wrap(cferr.PolicyError, cferr.UnauthorizedName,
+				fmt.Errorf("DNS name %s is not allowed", name))
+		}
+	}
+
+	for _, ip := range template.IPAddresses {
+		if !allowed.PermitsIP(ip) {
+			return cferr.Wrap(cferr.PolicyError, cferr.UnauthorizedName,
+				fmt.Errorf("IP address %s is not allowed", ip))
+		}
+	}
+
+	for _, email := range template.EmailAddresses {
+		if at := strings.LastIndex(email, "@"); at < 0 || !allowed.PermitsDNSName(email[at+1:]) {
+			return cferr.Wrap(cferr.PolicyError, cferr.UnauthorizedName,
+				fmt.Errorf("email address %s is not allowed", email))
+		}
+	}
+
+	for _, uri := range template.URIs {
+		if uri.Hostname() == "" || !allowed.PermitsDNSName(uri.Hostname()) {
+			return cferr.Wrap(cferr.PolicyError, cferr.UnauthorizedName,
+				fmt.Errorf("URI %s is not allowed", uri))
+		}
+	}
+
+	if cn := template.Subject.CommonName; cn != "" {
+		if ip := net.ParseIP(cn); ip != nil {
+			if !allowed.PermitsIP(ip) {
+				return cferr.Wrap(cferr.PolicyError, cferr.UnauthorizedName,
+					fmt.Errorf("common name %s is not allowed", cn))
+			}
+		} else if !allowed.PermitsDNSName(cn) {
+			return cferr.Wrap(cferr.PolicyError, cferr.UnauthorizedName,
+				fmt.Errorf("common name %s is not allowed", cn))
+		}
+	}
+
+	return nil
+}
+
+// checkKeyPolicy verifies that a certificate request's public key uses
+// one of the profile's allowed key algorithms, if it lists any, and is
+// at least the profile's minimum size for its algorithm.
+func checkKeyPolicy(pub interface{}, profile *config.SigningProfile) error {
+	algo := config.KeyAlgorithm(pub)
+	if algo == "" {
+		return cferr.Wrap(cferr.PolicyError, cferr.UnauthorizedKey,
+			errors.New("unsupported public key algorithm"))
+	}
+
+	if len(profile.AllowedKeyAlgorithms) > 0 {
+		var allowed bool
+		for _, a := range profile.AllowedKeyAlgorithms {
+			if a == algo {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return cferr.Wrap(cferr.PolicyError, cferr.UnauthorizedKey,
+				fmt.Errorf("%s keys are not allowed, expected one of %s",
+					algo, strings.Join(profile.AllowedKeyAlgorithms, ", ")))
+		}
+	}
+
+	if min, ok := profile.MinKeySize[algo]; ok {
+		if size := helpers.KeyLength(pub); size < min {
+			return cferr.Wrap(cferr.PolicyError, cferr.UnauthorizedKey,
+				fmt.Errorf("%d-bit %s key is smaller than the minimum of %d bits", size, algo, min))
+		}
+	}
+
+	return nil
+}
+
+// sigAlgoKeyAlgorithm returns the name of the key algorithm that signs
+// with algo.
+func sigAlgoKeyAlgorithm(algo x509.SignatureAlgorithm) string {
+	switch algo {
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		return config.RSAKeyAlgorithm
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		return config.ECDSAKeyAlgorithm
+	case x509.PureEd25519:
+		return config.Ed25519KeyAlgorithm
+	default:
+		return ""
+	}
+}
+
+// recordCertificate stores a newly issued certificate in the
+// signer's certificate store.
+func (s *Signer) recordCertificate(cert []byte, req signer.SignRequest) error {
+	parsedCert, err := helpers.ParseCertificatePEM(cert)
+	if err != nil {
+		return err
+	}
+
+	certRecord := certdb.CertificateRecord{
+		Serial:    parsedCert.SerialNumber.String(),
+		AKI:       hex.EncodeToString(parsedCert.AuthorityKeyId),
+		CALabel:   req.Label,
+		Profile:   req.Profile,
+		Requester: req.Requester,
+		Status:    certdb.StatusGood,
+		Expiry:    parsedCert.NotAfter,
+		PEM:       string(cert),
+	}
+
+	err = s.dbAccessor.InsertCertificate(certRecord)
+	if err != nil {
+		return err
+	}
+	log.Debugf("recorded certificate with serial number %s", certRecord.Serial)
+	return nil
 }
 
 // SigAlgo returns the RSA signer's signature algorithm.
@@ -246,3 +571,37 @@ func (s *Signer) SetPolicy(policy *config.Signing) {
 func (s *Signer) Policy() *config.Signing {
 	return s.policy
 }
+
+// SignCRL generates a DER-encoded CRL for req, signed with the
+// signer's CA certificate and private key.
+func (s *Signer) SignCRL(req crl.Request) ([]byte, error) {
+	if s.ca == nil {
+		return nil, errors.New("crl: the signer has no CA certificate")
+	}
+	return crl.Create(s.ca, s.priv, req)
+}
+
+// SetSerialGenerator sets the generator used for the serial numbers of
+// certificates the signer issues. With a nil generator, serial numbers
+// are random, of the length set by the signing profile.
+func (s *Signer) SetSerialGenerator(gen signer.SerialGenerator) {
+	s.serialGen = gen
+}
+
+// SetLabel sets the label that the signer is known by, as substituted
+// for the label variable in the profile's URLs.
+func (s *Signer) SetLabel(label string) {
+	s.label = label
+}
+
+// SetCTFetcher sets the Fetcher used to submit precertificates to CT
+// logs. With no Fetcher, helpers.DefaultFetcher is used.
+func (s *Signer) SetCTFetcher(f helpers.Fetcher) {
+	s.ctFetcher = f
+}
+
+// SetDBAccessor sets the certificate store in which the signer records
+// every certificate it issues.
+func (s *Signer) SetDBAccessor(dba certdb.Accessor) {
+	s.dbAccessor = dba
+}
@@ -3,16 +3,24 @@ package local
 import (
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/pem"
 	"io/ioutil"
+	"math/big"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/cloudflare/cfssl/certdb"
+	certsql "github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
 	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/ct"
+	"github.com/cloudflare/cfssl/ct/testlog"
+	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/signer"
@@ -150,20 +158,20 @@ func testSign(t *testing.T) {
 	badcert := *cert
 	badcert.PublicKey = nil
 	profl := config.SigningProfile{Usage: []string{"Certificates", "Rule"}}
-	_, err = signer.sign(&badcert, &profl, "")
+	_, err = signer.sign(&badcert, &profl, "", "")
 
 	if err == nil {
 		t.Fatal("Improper input failed to raise an error")
 	}
 
 	// nil profile
-	_, err = signer.sign(cert, &profl, "")
+	_, err = signer.sign(cert, &profl, "", "")
 	if err == nil {
 		t.Fatal("Nil profile failed to raise an error")
 	}
 
 	// empty profile
-	_, err = signer.sign(cert, &config.SigningProfile{}, "")
+	_, err = signer.sign(cert, &config.SigningProfile{}, "", "")
 	if err == nil {
 		t.Fatal("Empty profile failed to raise an error")
 	}
@@ -171,7 +179,7 @@ func testSign(t *testing.T) {
 	// empty expiry
 	prof := signer.policy.Default
 	prof.Expiry = 0
-	_, err = signer.sign(cert, prof, "")
+	_, err = signer.sign(cert, prof, "", "")
 	if err != nil {
 		t.Fatal("nil expiry raised an error")
 	}
@@ -181,7 +189,7 @@ func testSign(t *testing.T) {
 	prof.CRL = "stuff"
 	prof.OCSP = "stuff"
 	prof.IssuerURL = []string{"stuff"}
-	_, err = signer.sign(cert, prof, "")
+	_, err = signer.sign(cert, prof, "", "")
 	if err != nil {
 		t.Fatal("non nil urls raised an error")
 	}
@@ -191,12 +199,12 @@ func testSign(t *testing.T) {
 	prof = signer.policy.Default
 	prof.CA = false
 	nilca.ca = nil
-	_, err = nilca.sign(cert, prof, "")
+	_, err = nilca.sign(cert, prof, "", "")
 	if err == nil {
 		t.Fatal("nil ca with isca false raised an error")
 	}
 	prof.CA = true
-	_, err = nilca.sign(cert, prof, "")
+	_, err = nilca.sign(cert, prof, "", "")
 	if err != nil {
 		t.Fatal("nil ca with CA true raised an error")
 	}
@@ -455,7 +463,7 @@ func TestCAIssuing(t *testing.T) {
 			}
 			keyBytes, _ := ioutil.ReadFile(interKeys[j])
 			interKey, _ := helpers.ParsePrivateKeyPEM(keyBytes)
-			interSigner := &Signer{interCert, interKey, CAPolicy, signer.DefaultSigAlgo(interKey)}
+			interSigner := &Signer{ca: interCert, priv: interKey, policy: CAPolicy, sigAlgo: signer.DefaultSigAlgo(interKey)}
 			for _, anotherCSR := range interCSRs {
 				anotherCSRBytes, _ := ioutil.ReadFile(anotherCSR)
 				bytes, err := interSigner.Sign(
@@ -807,3 +815,628 @@ func TestWhitelistSign(t *testing.T) {
 			cert.SignatureAlgorithm)
 	}
 }
+
+func TestSignRecordsCertificate(t *testing.T) {
+	s := newTestSigner(t)
+	dba := certsql.NewAccessor(testdb.SQLiteDB())
+	s.SetDBAccessor(dba)
+
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := s.Sign(signer.SignRequest{
+		Hosts:     []string{"cloudflare.com"},
+		Request:   string(csrPEM),
+		Label:     "default",
+		Requester: "127.0.0.1:1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crs, err := dba.GetCertificate(cert.SerialNumber.String(), hex.EncodeToString(cert.AuthorityKeyId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crs) != 1 {
+		t.Fatalf("expected 1 recorded certificate, got %d", len(crs))
+	}
+
+	cr := crs[0]
+	if cr.PEM != string(certPEM) {
+		t.Fatal("recorded PEM does not match issued certificate")
+	}
+	if cr.Status != certdb.StatusGood || cr.CALabel != "default" || cr.Requester != "127.0.0.1:1234" {
+		t.Fatalf("unexpected certificate record: %+v", cr)
+	}
+	if !cr.Expiry.Equal(cert.NotAfter) {
+		t.Fatalf("recorded expiry %v does not match certificate %v", cr.Expiry, cert.NotAfter)
+	}
+}
+
+func TestAllowedNamesSign(t *testing.T) {
+	csrPEM, err := ioutil.ReadFile(fullSubjectCSR)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	policy, err := config.LoadConfig([]byte(`{
+		"signing": {
+			"default": {
+				"usages": ["signing", "key encipherment", "server auth"],
+				"expiry": "1h",
+				"allowed_names": {
+					"dns_suffixes": ["example.com"],
+					"dns_patterns": ["localhost|ip6-localhost"],
+					"ip_ranges": ["127.0.0.0/8"]
+				}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy = policy.Signing
+
+	for _, test := range []struct {
+		hosts   []string
+		cn      string
+		allowed bool
+	}{
+		{[]string{"127.0.0.1", "localhost", "www.example.com"}, "example.com", true},
+		{[]string{"127.0.0.1"}, "127.0.0.2", true},
+		{[]string{"www.example.org"}, "example.com", false},
+		{[]string{"10.0.0.1"}, "example.com", false},
+		{[]string{"www.example.com"}, "evilexample.com", false},
+		{[]string{"localhost.evil.com"}, "localhost", false},
+	} {
+		request := signer.SignRequest{
+			Hosts:   test.hosts,
+			Request: string(csrPEM),
+			Subject: &signer.Subject{CN: test.cn},
+		}
+
+		_, err := s.Sign(request)
+		if test.allowed && err != nil {
+			t.Fatalf("hosts %v, CN %s should be allowed: %v", test.hosts, test.cn, err)
+		}
+		if !test.allowed {
+			if err == nil {
+				t.Fatalf("hosts %v, CN %s should not be allowed", test.hosts, test.cn)
+			}
+			if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != 5400 {
+				t.Fatalf("expected an UnauthorizedName error, got %v", err)
+			}
+		}
+	}
+}
+
+func TestOverrideHostsSANTypes(t *testing.T) {
+	template := &x509.Certificate{DNSNames: []string{"csr.example.com"}}
+	OverrideHosts(template, []string{"example.com", "10.0.0.1", "admin@example.com", "spiffe://example.com/web"})
+
+	if len(template.DNSNames) != 1 || template.DNSNames[0] != "example.com" {
+		t.Fatalf("bad DNS names: %v", template.DNSNames)
+	}
+	if len(template.IPAddresses) != 1 || len(template.EmailAddresses) != 1 || len(template.URIs) != 1 {
+		t.Fatalf("SANs not classified: %v %v %v", template.IPAddresses, template.EmailAddresses, template.URIs)
+	}
+	if template.URIs[0].String() != "spiffe://example.com/web" {
+		t.Fatalf("bad URI: %v", template.URIs[0])
+	}
+}
+
+func TestSignEmailAndURISANs(t *testing.T) {
+	req := &csr.CertificateRequest{
+		CN:         "web",
+		Hosts:      []string{"admin@example.com", "spiffe://example.com/web"},
+		KeyRequest: &csr.KeyRequest{Algo: "ecdsa", Size: 256},
+	}
+	csrPEM, _, err := csr.ParseRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+	s.policy = &config.Signing{
+		Default: &config.SigningProfile{
+			Usage:        []string{"signing", "email protection", "client auth"},
+			ExpiryString: "1h",
+			Expiry:       1 * time.Hour,
+			CSRWhitelist: &config.CSRWhitelist{
+				PublicKey:          true,
+				PublicKeyAlgorithm: true,
+				EmailAddresses:     true,
+			},
+		},
+	}
+
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOneValueOf(t, cert.EmailAddresses, "admin@example.com", "EmailAddresses")
+	if len(cert.URIs) != 0 {
+		t.Fatalf("URIs not whitelisted but copied: %v", cert.URIs)
+	}
+
+	s.policy.Default.CSRWhitelist.URIs = true
+	s.policy.Default.AllowedNames = &config.AllowedNames{DNSSuffixes: []string{"example.org"}}
+	if _, err = s.Sign(signer.SignRequest{Request: string(csrPEM), Subject: &signer.Subject{CN: "example.org"}}); err == nil {
+		t.Fatal("email and URI SANs outside the allowed names were accepted")
+	}
+
+	s.policy.Default.AllowedNames.DNSSuffixes = []string{"example.com"}
+	certPEM, err = s.Sign(signer.SignRequest{Request: string(csrPEM), Subject: &signer.Subject{CN: "example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = helpers.ParseCertificatePEM(certPEM); err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.URIs) != 1 || cert.URIs[0].String() != "spiffe://example.com/web" {
+		t.Fatalf("URI SAN not copied: %v", cert.URIs)
+	}
+}
+
+func TestSignExtendedSubject(t *testing.T) {
+	req := &csr.CertificateRequest{
+		CN: "example.com",
+		Names: []csr.Name{
+			{O: "Example", E: "admin@example.com", DC: "example"},
+			{DC: "com"},
+		},
+		KeyRequest: &csr.KeyRequest{Algo: "ecdsa", Size: 256},
+	}
+	csrPEM, _, err := csr.ParseRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCustomSigner(t, testECDSACaFile, testECDSACaKeyFile)
+
+	// Attributes from the CSR are kept.
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(cert.Subject.Names); n != 5 {
+		t.Fatalf("expected 5 subject attributes, got %v", cert.Subject.Names)
+	}
+
+	// A subject override without extra attributes keeps the CSR's,
+	// and its serial number and street address are used.
+	subject := &signer.Subject{Names: []csr.Name{{O: "Override", SerialNumber: "42", Street: "1 Main St"}}}
+	certPEM, err = s.Sign(signer.SignRequest{Request: string(csrPEM), Subject: subject})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = helpers.ParseCertificatePEM(certPEM); err != nil {
+		t.Fatal(err)
+	}
+	expectOneValueOf(t, cert.Subject.Organization, "Override", "O")
+	expectOneValueOf(t, cert.Subject.StreetAddress, "1 Main St", "Street")
+	if cert.Subject.SerialNumber != "42" || cert.Subject.CommonName != "example.com" {
+		t.Fatalf("subject not overridden: %+v", cert.Subject)
+	}
+
+	var email string
+	for _, atv := range cert.Subject.Names {
+		if atv.Type.String() == "1.2.840.113549.1.9.1" {
+			email, _ = atv.Value.(string)
+		}
+	}
+	if email != "admin@example.com" {
+		t.Fatal("email address from the CSR was lost")
+	}
+}
+
+func TestSignEd25519AndPSS(t *testing.T) {
+	// A self-signed Ed25519 CA.
+	caCSR, caKeyPEM, err := csr.ParseRequest(&csr.CertificateRequest{
+		CN:         "Ed25519 CA",
+		KeyRequest: &csr.KeyRequest{Algo: "ed25519"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := helpers.ParsePrivateKeyPEM(caKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPolicy := &config.Signing{
+		Default: &config.SigningProfile{
+			Usage:  []string{"cert sign", "crl sign"},
+			Expiry: expiry,
+			CA:     true,
+		},
+	}
+	s, err := NewSigner(caKey, nil, signer.DefaultSigAlgo(caKey), caPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := s.Sign(signer.SignRequest{Request: string(caCSR)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.SignatureAlgorithm != x509.PureEd25519 || ca.PublicKeyAlgorithm != x509.Ed25519 {
+		t.Fatalf("unexpected CA algorithms %v and %v", ca.SignatureAlgorithm, ca.PublicKeyAlgorithm)
+	}
+
+	// The Ed25519 CA signs a CSR made with RSA-PSS.
+	pssCSR, _, err := csr.ParseRequest(&csr.CertificateRequest{
+		CN:         "example.com",
+		KeyRequest: &csr.KeyRequest{Algo: "rsa-pss", Size: 2048},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewSigner(caKey, ca, signer.DefaultSigAlgo(caKey), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := s.Sign(signer.SignRequest{Request: string(pssCSR)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cert.CheckSignatureFrom(ca); err != nil {
+		t.Fatal(err)
+	}
+
+	// An RSA CA signs with RSA-PSS.
+	rsaKeyPEM, err := ioutil.ReadFile(testCaKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := helpers.ParsePrivateKeyPEM(rsaKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaCAPEM, err := ioutil.ReadFile(testCaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaCA, err := helpers.ParseCertificatePEM(rsaCAPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewSigner(rsaKey, rsaCA, signer.DefaultPSSSigAlgo(rsaKey), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaCSR, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certPEM, err = s.Sign(signer.SignRequest{Request: string(ecdsaCSR)}); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = helpers.ParseCertificatePEM(certPEM); err != nil {
+		t.Fatal(err)
+	}
+	if cert.SignatureAlgorithm != s.SigAlgo() || s.SigAlgo() == x509.UnknownSignatureAlgorithm {
+		t.Fatalf("certificate signed with %v", cert.SignatureAlgorithm)
+	}
+	if err = cert.CheckSignatureFrom(rsaCA); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyPolicySign(t *testing.T) {
+	policy, err := config.LoadConfig([]byte(`{
+		"signing": {
+			"profiles": {
+				"strong": {
+					"usages": ["signing", "key encipherment", "server auth"],
+					"expiry": "1h",
+					"allowed_key_algorithms": ["rsa", "ecdsa"],
+					"min_key_size": {"rsa": 3072, "ecdsa": 384}
+				},
+				"rsa-only": {
+					"usages": ["signing", "key encipherment", "server auth"],
+					"expiry": "1h",
+					"allowed_key_algorithms": ["rsa"]
+				},
+				"pss": {
+					"usages": ["signing", "key encipherment", "server auth"],
+					"expiry": "1h",
+					"signature_algorithm": "SHA384WithRSAPSS"
+				},
+				"ecdsa-sig": {
+					"usages": ["signing", "key encipherment", "server auth"],
+					"expiry": "1h",
+					"signature_algorithm": "ECDSAWithSHA256"
+				}
+			},
+			"default": {
+				"usages": ["signing", "key encipherment", "server auth"],
+				"expiry": "1h"
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestSigner(t)
+	s.policy = policy.Signing
+
+	for _, test := range []struct {
+		csr     string
+		profile string
+		code    int
+	}{
+		{"testdata/rsa2048.csr", "strong", 5500},
+		{"testdata/rsa3072.csr", "strong", 0},
+		{"testdata/ecdsa256.csr", "strong", 5500},
+		{"testdata/ecdsa384.csr", "strong", 0},
+		{"testdata/ecdsa256.csr", "rsa-only", 5500},
+		{"testdata/rsa2048.csr", "rsa-only", 0},
+		{"testdata/ecdsa256.csr", "pss", 0},
+		{"testdata/ecdsa256.csr", "ecdsa-sig", 5200},
+		{"testdata/ecdsa256.csr", "", 0},
+	} {
+		csrPEM, err := ioutil.ReadFile(test.csr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		certPEM, err := s.Sign(signer.SignRequest{
+			Hosts:   []string{"example.com"},
+			Request: string(csrPEM),
+			Profile: test.profile,
+		})
+		if test.code != 0 {
+			if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != test.code {
+				t.Fatalf("%s with profile %q: expected error %d, got %v", test.csr, test.profile, test.code, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s with profile %q: %v", test.csr, test.profile, err)
+		}
+
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := s.SigAlgo()
+		if test.profile == "pss" {
+			expected = x509.SHA384WithRSAPSS
+		}
+		if cert.SignatureAlgorithm != expected {
+			t.Fatalf("%s with profile %q: signed with %v, expected %v", test.csr, test.profile, cert.SignatureAlgorithm, expected)
+		}
+		if err = cert.CheckSignatureFrom(s.ca); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// fixedSerials hands out a fixed series of serial numbers, repeating
+// the last one.
+type fixedSerials struct {
+	serials []int64
+}
+
+func (f *fixedSerials) Serial(seq string) (*big.Int, error) {
+	serial := f.serials[0]
+	if len(f.serials) > 1 {
+		f.serials = f.serials[1:]
+	}
+	return big.NewInt(serial), nil
+}
+
+func TestSignUniqueSerial(t *testing.T) {
+	s := newTestSigner(t)
+	dba := certsql.NewAccessor(testdb.SQLiteDB())
+	s.SetDBAccessor(dba)
+
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csrPEM)}
+
+	s.SetSerialGenerator(&fixedSerials{serials: []int64{1}})
+	if _, err = s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Serial number 1 is taken, so the signer moves on to 2.
+	s.SetSerialGenerator(&fixedSerials{serials: []int64{1, 1, 2}})
+	certPEM, err := s.Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SerialNumber.Int64() != 2 {
+		t.Fatalf("expected serial number 2, got %v", cert.SerialNumber)
+	}
+
+	// A generator that only produces used serial numbers fails.
+	s.SetSerialGenerator(&fixedSerials{serials: []int64{2}})
+	_, err = s.Sign(req)
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != 1500 {
+		t.Fatalf("expected a DuplicateSerial error, got %v", err)
+	}
+
+	// The default generator uses the profile's serial length.
+	s.SetSerialGenerator(nil)
+	s.policy.Default.SerialLength = 19
+	if certPEM, err = s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = helpers.ParseCertificatePEM(certPEM); err != nil {
+		t.Fatal(err)
+	}
+	if cert.SerialNumber.BitLen() <= 64 || cert.SerialNumber.BitLen() > 152 {
+		t.Fatalf("unexpected serial number length %d bits", cert.SerialNumber.BitLen())
+	}
+}
+
+func TestSignCT(t *testing.T) {
+	logs := []*testlog.Log{testlog.New(), testlog.New()}
+	for _, l := range logs {
+		defer l.Close()
+	}
+
+	s := newTestSigner(t)
+	for _, l := range logs {
+		s.policy.Default.CTLogServers = append(s.policy.Default.CTLogServers, l.URL)
+		s.policy.Default.CTLogPublicKeys = append(s.policy.Default.CTLogPublicKeys, l.Key.Public())
+	}
+
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csrPEM)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scts []*ct.SignedCertificateTimestamp
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(ct.PoisonOID) {
+			t.Fatal("certificate carries the precertificate poison")
+		}
+		if ext.Id.Equal(ct.SCTListOID) {
+			if scts, err = ct.ParseSCTList(ext.Value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if len(scts) != len(logs) {
+		t.Fatalf("expected %d SCTs, got %d", len(logs), len(scts))
+	}
+	for i, l := range logs {
+		if l.Submissions() != 1 {
+			t.Fatalf("log %d got %d submissions", i, l.Submissions())
+		}
+		if err = ct.VerifySCT(l.Key.Public(), scts[i], cert, s.ca); err != nil {
+			t.Fatalf("log %d: %v", i, err)
+		}
+	}
+
+	// An SCT that doesn't verify under the log's key fails the
+	// signature.
+	s.policy.Default.CTLogPublicKeys[1] = logs[0].Key.Public()
+	_, err = s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csrPEM)})
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != 11100 {
+		t.Fatalf("expected a PrecertSubmitFailed error, got %v", err)
+	}
+	s.policy.Default.CTLogPublicKeys[1] = logs[1].Key.Public()
+
+	// A log that can't be reached fails the signature.
+	logs[1].Close()
+	_, err = s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csrPEM)})
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != 11100 {
+		t.Fatalf("expected a PrecertSubmitFailed error, got %v", err)
+	}
+}
+
+func TestSignURLTemplates(t *testing.T) {
+	s := newTestSigner(t)
+	s.SetLabel("primary")
+	issuerURLs := []string{"http://ca.example.com/{label}.crt"}
+	s.policy.Default.IssuerURL = issuerURLs
+	s.policy.Default.OCSP = "http://ocsp.example.com/{ski}"
+	s.policy.Default.CRL = "http://crl.example.com/{label}/{serial}.crl"
+
+	// The profile has no URLs of its own, so the default's are used.
+	s.policy.Profiles = map[string]*config.SigningProfile{
+		"server": {Usage: []string{"server auth"}, Expiry: time.Hour},
+	}
+
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csrPEM), Profile: "server"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ski := hex.EncodeToString(s.ca.SubjectKeyId)
+	if len(cert.IssuingCertificateURL) != 1 || cert.IssuingCertificateURL[0] != "http://ca.example.com/primary.crt" {
+		t.Fatalf("unexpected issuer URLs %v", cert.IssuingCertificateURL)
+	}
+	if len(cert.OCSPServer) != 1 || cert.OCSPServer[0] != "http://ocsp.example.com/"+ski {
+		t.Fatalf("unexpected OCSP servers %v", cert.OCSPServer)
+	}
+	crlURL := "http://crl.example.com/primary/" + s.ca.SerialNumber.String() + ".crl"
+	if len(cert.CRLDistributionPoints) != 1 || cert.CRLDistributionPoints[0] != crlURL {
+		t.Fatalf("unexpected CRL distribution points %v", cert.CRLDistributionPoints)
+	}
+
+	// The templates in the policy are left as they were.
+	if issuerURLs[0] != "http://ca.example.com/{label}.crt" {
+		t.Fatalf("policy issuer URL was rewritten to %s", issuerURLs[0])
+	}
+}
+
+func TestSignURLTemplatesRequestLabel(t *testing.T) {
+	// A signer that is not part of a multirootca has no label, so the
+	// label comes from the request.
+	s := newTestSigner(t)
+	s.policy.Default.IssuerURL = []string{"http://ca.example.com/{label}.crt"}
+
+	csrPEM, err := ioutil.ReadFile(testCSR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, err := s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csrPEM), Label: "secondary"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.IssuingCertificateURL) != 1 || cert.IssuingCertificateURL[0] != "http://ca.example.com/secondary.crt" {
+		t.Fatalf("unexpected issuer URLs %v", cert.IssuingCertificateURL)
+	}
+
+	// Without any label, the URL can't be filled in.
+	_, err = s.Sign(signer.SignRequest{Hosts: []string{"cloudflare.com"}, Request: string(csrPEM)})
+	if cfErr, ok := err.(*cferr.Error); !ok || cfErr.ErrorCode != 5300 {
+		t.Fatalf("expected an InvalidRequest error, got %v", err)
+	}
+}
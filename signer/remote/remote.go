@@ -6,6 +6,7 @@ import (
 	"errors"
 
 	"github.com/cloudflare/cfssl/api/client"
+	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/config"
 	cferr "github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/helpers"
@@ -112,3 +113,8 @@ func (s *Signer) SetPolicy(policy *config.Signing) {
 func (s *Signer) Policy() *config.Signing {
 	return s.policy
 }
+
+// SetDBAccessor is a no-op for a remote signer: certificates are
+// recorded by the CFSSL instance that actually signs them.
+func (s *Signer) SetDBAccessor(certdb.Accessor) {
+}
@@ -0,0 +1,98 @@
+package signer
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+)
+
+const (
+	// DefaultSerialLength is the number of random bytes in a serial
+	// number when no length is configured.
+	DefaultSerialLength = 16
+
+	// DefaultSeqSerialLength is the number of random bytes that follow
+	// a serial number sequence prefix when no length is configured.
+	DefaultSeqSerialLength = 8
+
+	// MinSerialLength is the fewest random bytes allowed in a serial
+	// number, giving the 64 bits of entropy the CA/Browser Forum
+	// Baseline Requirements call for.
+	MinSerialLength = 8
+
+	// MaxSerialLength is the size, in bytes, of the largest encoded
+	// serial number that RFC 5280 allows. As the encoding may need a
+	// leading zero byte to keep the number positive, at most
+	// MaxSerialLength-1 bytes of it can be random.
+	MaxSerialLength = 20
+)
+
+// A SerialGenerator produces serial numbers for new certificates. seq,
+// if it is not empty, is a hex-encoded sequence that the serial number
+// must begin with.
+type SerialGenerator interface {
+	Serial(seq string) (*big.Int, error)
+}
+
+// RandomSerialGenerator generates serial numbers from Length random
+// bytes, after the sequence prefix if there is one. A zero Length
+// means DefaultSerialLength, or DefaultSeqSerialLength when a prefix is
+// given.
+type RandomSerialGenerator struct {
+	Length int
+	// Rand is the source of randomness; if nil, crypto/rand.Reader
+	// is used.
+	Rand io.Reader
+}
+
+// Serial returns a new positive serial number.
+func (g *RandomSerialGenerator) Serial(seq string) (*big.Int, error) {
+	length := g.Length
+	if length == 0 {
+		length = DefaultSerialLength
+		if seq != "" {
+			length = DefaultSeqSerialLength
+		}
+	}
+	if length < MinSerialLength || length > MaxSerialLength-1 {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown,
+			fmt.Errorf("serial length must be between %d and %d bytes", MinSerialLength, MaxSerialLength-1))
+	}
+
+	r := g.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+
+	if strings.Trim(seq, "0123456789abcdefABCDEF") != "" {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.SerialSeqParseError,
+			errors.New("serial number sequence is not hex: "+seq))
+	}
+
+	random := make([]byte, length)
+	for {
+		if _, err := io.ReadFull(r, random); err != nil {
+			return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+		}
+
+		serial, _ := new(big.Int).SetString(fmt.Sprintf("%s%X", seq, random), 16)
+
+		// The DER encoding of the serial number, including any
+		// leading zero byte needed to keep it positive, must fit in
+		// MaxSerialLength bytes.
+		if serial.BitLen() > 8*MaxSerialLength-1 {
+			return nil, cferr.Wrap(cferr.CertificateError, cferr.SerialSeqParseError,
+				fmt.Errorf("serial number sequence %s is too long for a %d-byte random part", seq, length))
+		}
+
+		// Serial numbers must be positive, so a zero is drawn again.
+		if serial.Sign() > 0 {
+			return serial, nil
+		}
+	}
+}
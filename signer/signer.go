@@ -4,20 +4,19 @@ package signer
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"errors"
-	"fmt"
-	"math"
 	"math/big"
 	"strings"
 	"time"
 
+	"github.com/cloudflare/cfssl/certdb"
 	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/csr"
 	cferr "github.com/cloudflare/cfssl/errors"
@@ -30,7 +29,9 @@ var MaxPathLen = 2
 // value is false, a whitelist should only keep those fields marked
 // true.
 type Whitelist struct {
-	CN, C, ST, L, O, OU bool
+	CN, C, ST, L, O, OU                     bool
+	SerialNumber, Street, PostalCode, E, DC bool
+	OIDs                                    bool
 }
 
 // Subject contains the information that should be used to override the
@@ -43,6 +44,10 @@ type Subject struct {
 
 // SignRequest stores a signature request, which contains the hostname,
 // the CSR, optional subject information, and the signature profile.
+//
+// Requester identifies the client asking for the certificate and is
+// recorded alongside the issued certificate. It is filled in by the
+// server handling the request and is never read from the wire.
 type SignRequest struct {
 	Hosts     []string `json:"hosts"`
 	Request   string   `json:"certificate_request"`
@@ -50,28 +55,48 @@ type SignRequest struct {
 	Profile   string   `json:"profile"`
 	Label     string   `json:"label"`
 	SerialSeq string   `json:"serial_sequence,omitempty"`
-}
-
-// appendIf appends to a if s is not an empty string.
-func appendIf(s string, a *[]string) {
-	if s != "" {
-		*a = append(*a, s)
-	}
+	Requester string   `json:"-"`
 }
 
 // Name returns the PKIX name for the subject.
 func (s *Subject) Name() pkix.Name {
-	var name pkix.Name
-	name.CommonName = s.CN
+	req := csr.CertificateRequest{CN: s.CN, Names: s.Names}
+	return req.Name()
+}
 
-	for _, n := range s.Names {
-		appendIf(n.C, &name.Country)
-		appendIf(n.ST, &name.Province)
-		appendIf(n.L, &name.Locality)
-		appendIf(n.O, &name.Organization)
-		appendIf(n.OU, &name.OrganizationalUnit)
+// standardAttributes are the attribute types that pkix.Name has
+// fields for.
+var standardAttributes = []asn1.ObjectIdentifier{
+	{2, 5, 4, 3},  // commonName
+	{2, 5, 4, 5},  // serialNumber
+	{2, 5, 4, 6},  // countryName
+	{2, 5, 4, 7},  // localityName
+	{2, 5, 4, 8},  // stateOrProvinceName
+	{2, 5, 4, 9},  // streetAddress
+	{2, 5, 4, 10}, // organizationName
+	{2, 5, 4, 11}, // organizationalUnitName
+	{2, 5, 4, 17}, // postalCode
+}
+
+// extraAttributes returns the attributes of a parsed name that
+// pkix.Name has no field for, such as email addresses and domain
+// components. They must be carried in ExtraNames to be kept when the
+// name is used in a certificate template.
+func extraAttributes(name pkix.Name) []pkix.AttributeTypeAndValue {
+	var extra []pkix.AttributeTypeAndValue
+	for _, atv := range name.Names {
+		standard := false
+		for _, oid := range standardAttributes {
+			if atv.Type.Equal(oid) {
+				standard = true
+				break
+			}
+		}
+		if !standard {
+			extra = append(extra, atv)
+		}
 	}
-	return name
+	return extra
 }
 
 // SplitHosts takes a comma-spearated list of hosts and returns a slice
@@ -86,10 +111,13 @@ func SplitHosts(hostList string) []string {
 
 // A Signer contains a CA's certificate and private key for signing
 // certificates, a Signing policy to refer to and a SignatureAlgorithm.
+// If a certificate store is set with SetDBAccessor, every certificate
+// issued is recorded in it.
 type Signer interface {
 	Certificate(label, profile string) (*x509.Certificate, error)
 	Policy() *config.Signing
 	SetPolicy(*config.Signing)
+	SetDBAccessor(certdb.Accessor)
 	SigAlgo() x509.SignatureAlgorithm
 	Sign(req SignRequest) (cert []byte, err error)
 }
@@ -122,11 +150,33 @@ func DefaultSigAlgo(priv crypto.Signer) x509.SignatureAlgorithm {
 		default:
 			return x509.ECDSAWithSHA1
 		}
+	case ed25519.PublicKey:
+		return x509.PureEd25519
 	default:
 		return x509.UnknownSignatureAlgorithm
 	}
 }
 
+// DefaultPSSSigAlgo returns an appropriate RSASSA-PSS signature
+// algorithm given the CA's RSA private key. For keys other than RSA,
+// it returns x509.UnknownSignatureAlgorithm.
+func DefaultPSSSigAlgo(priv crypto.Signer) x509.SignatureAlgorithm {
+	pub, ok := priv.Public().(*rsa.PublicKey)
+	if !ok {
+		return x509.UnknownSignatureAlgorithm
+	}
+
+	keySize := pub.N.BitLen()
+	switch {
+	case keySize >= 4096:
+		return x509.SHA512WithRSAPSS
+	case keySize >= 3072:
+		return x509.SHA384WithRSAPSS
+	default:
+		return x509.SHA256WithRSAPSS
+	}
+}
+
 // ParseCertificateRequest takes an incoming certificate request and
 // builds a certificate template from it.
 func ParseCertificateRequest(s Signer, csrBytes []byte) (template *x509.Certificate, err error) {
@@ -142,13 +192,18 @@ func ParseCertificateRequest(s Signer, csrBytes []byte) (template *x509.Certific
 		return
 	}
 
+	subject := csr.Subject
+	subject.ExtraNames = extraAttributes(csr.Subject)
+
 	template = &x509.Certificate{
-		Subject:            csr.Subject,
+		Subject:            subject,
 		PublicKeyAlgorithm: csr.PublicKeyAlgorithm,
 		PublicKey:          csr.PublicKey,
 		SignatureAlgorithm: s.SigAlgo(),
 		DNSNames:           csr.DNSNames,
 		IPAddresses:        csr.IPAddresses,
+		EmailAddresses:     csr.EmailAddresses,
+		URIs:               csr.URIs,
 	}
 
 	return
@@ -157,7 +212,19 @@ func ParseCertificateRequest(s Signer, csrBytes []byte) (template *x509.Certific
 // CheckSignature verifies a signature made by the key on a CSR, such
 // as on the CSR itself.
 func CheckSignature(csr *x509.CertificateRequest, algo x509.SignatureAlgorithm, signed, signature []byte) error {
+	if algo == x509.PureEd25519 {
+		pub, ok := csr.PublicKey.(ed25519.PublicKey)
+		if !ok {
+			return x509.ErrUnsupportedAlgorithm
+		}
+		if !ed25519.Verify(pub, signed, signature) {
+			return errors.New("x509: Ed25519 verification failure")
+		}
+		return nil
+	}
+
 	var hashType crypto.Hash
+	var pss bool
 
 	switch algo {
 	case x509.SHA1WithRSA, x509.ECDSAWithSHA1:
@@ -168,6 +235,12 @@ func CheckSignature(csr *x509.CertificateRequest, algo x509.SignatureAlgorithm,
 		hashType = crypto.SHA384
 	case x509.SHA512WithRSA, x509.ECDSAWithSHA512:
 		hashType = crypto.SHA512
+	case x509.SHA256WithRSAPSS:
+		hashType, pss = crypto.SHA256, true
+	case x509.SHA384WithRSAPSS:
+		hashType, pss = crypto.SHA384, true
+	case x509.SHA512WithRSAPSS:
+		hashType, pss = crypto.SHA512, true
 	default:
 		return x509.ErrUnsupportedAlgorithm
 	}
@@ -182,8 +255,14 @@ func CheckSignature(csr *x509.CertificateRequest, algo x509.SignatureAlgorithm,
 
 	switch pub := csr.PublicKey.(type) {
 	case *rsa.PublicKey:
+		if pss {
+			return rsa.VerifyPSS(pub, hashType, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
 		return rsa.VerifyPKCS1v15(pub, hashType, digest, signature)
 	case *ecdsa.PublicKey:
+		if pss {
+			return x509.ErrUnsupportedAlgorithm
+		}
 		ecdsaSig := new(struct{ R, S *big.Int })
 		if _, err := asn1.Unmarshal(signature, ecdsaSig); err != nil {
 			return err
@@ -227,7 +306,9 @@ func ComputeSKI(template *x509.Certificate) ([]byte, error) {
 // FillTemplate is a utility function that tries to load as much of
 // the certificate template as possible from the profiles and current
 // template. It fills in the key uses, expiration, revocation URLs,
-// serial number, and SKI.
+// serial number, and SKI. A serial number already in the template is
+// kept; otherwise a random one is drawn, after serialSeq if it is not
+// empty.
 func FillTemplate(template *x509.Certificate, defaultProfile, profile *config.SigningProfile, serialSeq string) error {
 	ski, err := ComputeSKI(template)
 
@@ -281,21 +362,13 @@ func FillTemplate(template *x509.Certificate, defaultProfile, profile *config.Si
 		notAfter = notBefore.Add(expiry).UTC()
 	}
 
-	serialNumber, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64))
-
-	if err != nil {
-		return cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
-	}
-
-	if serialSeq != "" {
-		randomPart := fmt.Sprintf("%016X", serialNumber) // 016 ensures we're left-0-padded
-		_, ok := serialNumber.SetString(serialSeq+randomPart, 16)
-		if !ok {
-			return cferr.Wrap(cferr.CertificateError, cferr.SerialSeqParseError, err)
+	if template.SerialNumber == nil {
+		gen := &RandomSerialGenerator{Length: profile.SerialLength}
+		if template.SerialNumber, err = gen.Serial(serialSeq); err != nil {
+			return err
 		}
 	}
 
-	template.SerialNumber = serialNumber
 	template.NotBefore = notBefore
 	template.NotAfter = notAfter
 	template.KeyUsage = ku
@@ -316,6 +389,22 @@ func FillTemplate(template *x509.Certificate, defaultProfile, profile *config.Si
 	}
 	if len(profile.Policies) != 0 {
 		template.PolicyIdentifiers = profile.Policies
+		if hasPolicyQualifiers(profile.CertificatePolicies) {
+			ext, err := certificatePoliciesExtension(profile.Policies, profile.CertificatePolicies)
+			if err != nil {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+			}
+			template.ExtraExtensions = append(template.ExtraExtensions, ext)
+		}
+	}
+	if nc := profile.NameConstraints; profile.CA && nc != nil {
+		template.PermittedDNSDomainsCritical = true
+		template.PermittedDNSDomains = nc.PermittedDNSDomains
+		template.ExcludedDNSDomains = nc.ExcludedDNSDomains
+		template.PermittedIPRanges = nc.PermittedIPNets
+		template.ExcludedIPRanges = nc.ExcludedIPNets
+		template.PermittedEmailAddresses = nc.PermittedEmailAddresses
+		template.ExcludedEmailAddresses = nc.ExcludedEmailAddresses
 	}
 	if profile.OCSPNoCheck {
 		ocspNoCheckExtension := pkix.Extension{
@@ -326,5 +415,87 @@ func FillTemplate(template *x509.Certificate, defaultProfile, profile *config.Si
 		template.ExtraExtensions = append(template.ExtraExtensions, ocspNoCheckExtension)
 	}
 
+	// Extensions declared in the profile replace any generated above.
+	for _, ext := range profile.Extensions {
+		extra := template.ExtraExtensions[:0]
+		for _, e := range template.ExtraExtensions {
+			if !e.Id.Equal(ext.Id) {
+				extra = append(extra, e)
+			}
+		}
+		template.ExtraExtensions = append(extra, ext)
+	}
+
 	return nil
 }
+
+var (
+	oidExtensionCertificatePolicies = asn1.ObjectIdentifier{2, 5, 29, 32}
+	oidPolicyQualifierCPS           = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+	oidPolicyQualifierUserNotice    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 2}
+)
+
+// The following are the ASN.1 structures of RFC 5280 section 4.2.1.4
+// for certificate policies with qualifiers, which crypto/x509 cannot
+// produce.
+type policyInformation struct {
+	PolicyIdentifier asn1.ObjectIdentifier
+	Qualifiers       []policyQualifierInfo `asn1:"optional,omitempty"`
+}
+
+type policyQualifierInfo struct {
+	PolicyQualifierID asn1.ObjectIdentifier
+	Qualifier         asn1.RawValue
+}
+
+type userNotice struct {
+	ExplicitText string `asn1:"utf8"`
+}
+
+func hasPolicyQualifiers(policies []config.CertificatePolicy) bool {
+	for _, policy := range policies {
+		if len(policy.Qualifiers) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// certificatePoliciesExtension builds the certificate policies
+// extension for the parsed policy OIDs of a profile, with the
+// qualifiers of the corresponding profile policies.
+func certificatePoliciesExtension(oids []asn1.ObjectIdentifier, policies []config.CertificatePolicy) (pkix.Extension, error) {
+	var ext pkix.Extension
+	infos := make([]policyInformation, len(oids))
+	for i, oid := range oids {
+		infos[i].PolicyIdentifier = oid
+		if i >= len(policies) {
+			continue
+		}
+
+		for _, q := range policies[i].Qualifiers {
+			var info policyQualifierInfo
+			var err error
+			switch q.Type {
+			case config.CPSQualifierType:
+				info.PolicyQualifierID = oidPolicyQualifierCPS
+				info.Qualifier.FullBytes, err = asn1.MarshalWithParams(q.Value, "ia5")
+			case config.UserNoticeQualifierType:
+				info.PolicyQualifierID = oidPolicyQualifierUserNotice
+				info.Qualifier.FullBytes, err = asn1.Marshal(userNotice{ExplicitText: q.Value})
+			default:
+				err = errors.New("unknown policy qualifier type " + q.Type)
+			}
+			if err != nil {
+				return ext, err
+			}
+			infos[i].Qualifiers = append(infos[i].Qualifiers, info)
+		}
+	}
+
+	value, err := asn1.Marshal(infos)
+	if err != nil {
+		return ext, err
+	}
+	return pkix.Extension{Id: oidExtensionCertificatePolicies, Value: value}, nil
+}
@@ -1,7 +1,23 @@
 package signer
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/config"
 )
 
 func TestSplitHosts(t *testing.T) {
@@ -23,3 +39,246 @@ func TestSplitHosts(t *testing.T) {
 		t.Fatal("SplitHost fails to split multiple domains")
 	}
 }
+
+func TestFillTemplateNameConstraints(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := &config.SigningProfile{
+		Usage:  []string{"cert sign", "crl sign"},
+		Expiry: time.Hour,
+		CA:     true,
+		NameConstraints: &config.NameConstraints{
+			PermittedDNSDomains:    []string{"example.com"},
+			ExcludedEmailAddresses: []string{".example.com"},
+		},
+	}
+
+	template := &x509.Certificate{PublicKey: key.Public()}
+	if err = FillTemplate(template, config.DefaultConfig(), profile, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !template.PermittedDNSDomainsCritical || len(template.PermittedDNSDomains) != 1 ||
+		len(template.ExcludedEmailAddresses) != 1 {
+		t.Fatal("FillTemplate did not set the name constraints")
+	}
+
+	profile.CA = false
+	template = &x509.Certificate{PublicKey: key.Public()}
+	if err = FillTemplate(template, config.DefaultConfig(), profile, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(template.PermittedDNSDomains) != 0 {
+		t.Fatal("FillTemplate set name constraints on a non-CA certificate")
+	}
+}
+
+func TestFillTemplatePoliciesAndExtensions(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.LoadConfig([]byte(`{
+		"signing": {
+			"default": {
+				"usages": ["digital signature"],
+				"expiry": "1h",
+				"ocsp_no_check": true,
+				"policies": [
+					"2.23.140.1.2.1",
+					{
+						"id": "1.2.3.4",
+						"qualifiers": [
+							{"type": "id-qt-cps", "value": "http://cps.example.com"},
+							{"type": "id-qt-unotice", "value": "For internal use only"}
+						]
+					}
+				],
+				"extensions": [
+					{"id": "1.3.6.1.5.5.7.48.1.5", "critical": true, "value": "0500"},
+					{"id": "1.3.6.1.4.1.99999.1", "value": "0c0568656c6c6f"}
+				]
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := cfg.Signing.Default
+
+	template := &x509.Certificate{PublicKey: key.Public()}
+	if err = FillTemplate(template, profile, profile, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exts := map[string]pkix.Extension{}
+	for _, ext := range cert.Extensions {
+		if _, ok := exts[ext.Id.String()]; ok {
+			t.Fatalf("duplicate extension %s", ext.Id)
+		}
+		exts[ext.Id.String()] = ext
+	}
+
+	if ext := exts["1.3.6.1.5.5.7.48.1.5"]; !ext.Critical {
+		t.Fatal("profile extension did not replace the OCSP no check extension")
+	}
+	if ext, ok := exts["1.3.6.1.4.1.99999.1"]; !ok || ext.Critical {
+		t.Fatal("custom extension missing")
+	}
+
+	var policies []policyInformation
+	if _, err = asn1.Unmarshal(exts["2.5.29.32"].Value, &policies); err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 2 || len(policies[0].Qualifiers) != 0 || len(policies[1].Qualifiers) != 2 {
+		t.Fatalf("unexpected policies %+v", policies)
+	}
+
+	var cps string
+	if _, err = asn1.Unmarshal(policies[1].Qualifiers[0].Qualifier.FullBytes, &cps); err != nil || cps != "http://cps.example.com" {
+		t.Fatalf("bad CPS qualifier %q: %v", cps, err)
+	}
+	var notice userNotice
+	if _, err = asn1.Unmarshal(policies[1].Qualifiers[1].Qualifier.FullBytes, &notice); err != nil || notice.ExplicitText != "For internal use only" {
+		t.Fatalf("bad user notice %+v: %v", notice, err)
+	}
+	if len(cert.PolicyIdentifiers) != 2 {
+		t.Fatalf("certificate policies not parsed: %v", cert.PolicyIdentifiers)
+	}
+}
+
+func TestCheckSignaturePSSAndEd25519(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  crypto.Signer
+		algo x509.SignatureAlgorithm
+	}{
+		{rsaKey, x509.SHA256WithRSAPSS},
+		{rsaKey, x509.SHA384WithRSAPSS},
+		{rsaKey, x509.SHA512WithRSAPSS},
+		{edKey, x509.PureEd25519},
+	}
+
+	for _, test := range tests {
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:            pkix.Name{CommonName: "example.com"},
+			SignatureAlgorithm: test.algo,
+		}, test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = CheckSignature(csr, csr.SignatureAlgorithm, csr.RawTBSCertificateRequest, csr.Signature); err != nil {
+			t.Fatalf("%v: %v", test.algo, err)
+		}
+
+		csr.Signature[len(csr.Signature)-1] ^= 1
+		if err = CheckSignature(csr, csr.SignatureAlgorithm, csr.RawTBSCertificateRequest, csr.Signature); err == nil {
+			t.Fatalf("%v: bad signature accepted", test.algo)
+		}
+	}
+}
+
+func TestDefaultSigAlgo(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 3072)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if algo := DefaultSigAlgo(edKey); algo != x509.PureEd25519 {
+		t.Fatalf("expected Ed25519, got %v", algo)
+	}
+	if algo := DefaultSigAlgo(rsaKey); algo != x509.SHA384WithRSA {
+		t.Fatalf("expected SHA384WithRSA, got %v", algo)
+	}
+	if algo := DefaultPSSSigAlgo(rsaKey); algo != x509.SHA384WithRSAPSS {
+		t.Fatalf("expected SHA384WithRSAPSS, got %v", algo)
+	}
+	if algo := DefaultPSSSigAlgo(edKey); algo != x509.UnknownSignatureAlgorithm {
+		t.Fatalf("PSS is only defined for RSA keys, got %v", algo)
+	}
+}
+
+func TestRandomSerialGenerator(t *testing.T) {
+	gen := &RandomSerialGenerator{}
+	for i := 0; i < 64; i++ {
+		serial, err := gen.Serial("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if serial.Sign() <= 0 || serial.BitLen() > 8*DefaultSerialLength {
+			t.Fatalf("bad serial number %X", serial)
+		}
+	}
+
+	// The largest random part always fits in 20 encoded bytes.
+	gen = &RandomSerialGenerator{Length: MaxSerialLength - 1}
+	for i := 0; i < 64; i++ {
+		if _, err := gen.Serial(""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A sequence prefix is followed by the random part.
+	gen = &RandomSerialGenerator{}
+	serial, err := gen.Serial("7007F")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sn := fmt.Sprintf("%X", serial); !strings.HasPrefix(sn, "7007F") || len(sn) != 5+2*DefaultSeqSerialLength {
+		t.Fatalf("bad sequenced serial number %s", sn)
+	}
+
+	// A zero draw is replaced.
+	gen = &RandomSerialGenerator{Length: 8, Rand: io.MultiReader(bytes.NewReader(make([]byte, 8)), bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7, 8}))}
+	if serial, err = gen.Serial(""); err != nil {
+		t.Fatal(err)
+	}
+	if serial.Uint64() != 0x0102030405060708 {
+		t.Fatalf("bad serial number %X", serial)
+	}
+
+	for _, bad := range []struct {
+		length int
+		seq    string
+	}{
+		{7, ""},
+		{MaxSerialLength, ""},
+		{0, "-1"},
+		{0, "nothex"},
+		{MaxSerialLength - 1, "FF"},
+	} {
+		gen = &RandomSerialGenerator{Length: bad.length}
+		if _, err = gen.Serial(bad.seq); err == nil {
+			t.Fatalf("length %d and sequence %q should fail", bad.length, bad.seq)
+		}
+	}
+}
@@ -29,30 +29,40 @@ const (
 	MD2Ubiquity         HashUbiquity = 0
 )
 
+// RSASSA-PSS signatures use SHA2 but are understood by fewer
+// platforms than PKCS #1 v1.5 signatures.
+const (
+	RSAPSSUbiquity HashUbiquity = 40
+)
+
 // RSA and DSA are considered ubiquitous. ECDSA256 and ECDSA384 should be
 // supported by TLS 1.2 and have limited support from TLS 1.0 and
 // 1.1, based on RFC6460, but ECDSA521 is less well-supported as
-// a standard.
+// a standard. Ed25519 certificates are only accepted by recent
+// TLS 1.3 implementations.
 const (
 	RSAUbiquity         KeyAlgoUbiquity = 100
 	DSAUbiquity         KeyAlgoUbiquity = 100
 	ECDSA256Ubiquity    KeyAlgoUbiquity = 70
 	ECDSA384Ubiquity    KeyAlgoUbiquity = 70
 	ECDSA521Ubiquity    KeyAlgoUbiquity = 30
+	Ed25519Ubiquity     KeyAlgoUbiquity = 10
 	UnknownAlgoUbiquity KeyAlgoUbiquity = 0
 )
 
 // hashUbiquity computes the ubiquity of the hash algorithm in the
 // signature algorithm of a cert.
-// SHA1 > SHA2 > MD > Others
+// SHA1 > SHA2 > RSA-PSS > MD > Others
 func hashUbiquity(cert *x509.Certificate) HashUbiquity {
 	switch cert.SignatureAlgorithm {
 	case x509.ECDSAWithSHA1, x509.DSAWithSHA1, x509.SHA1WithRSA:
 		return SHA1Ubiquity
 	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512,
 		x509.DSAWithSHA256, x509.SHA256WithRSA, x509.SHA384WithRSA,
-		x509.SHA512WithRSA:
+		x509.SHA512WithRSA, x509.PureEd25519:
 		return SHA2Ubiquity
+	case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		return RSAPSSUbiquity
 	case x509.MD5WithRSA, x509.MD2WithRSA:
 		return MD5Ubiquity
 	default:
@@ -61,9 +71,11 @@ func hashUbiquity(cert *x509.Certificate) HashUbiquity {
 }
 
 // keyAlgoUbiquity compute the ubiquity of the cert's public key algorithm
-// RSA, DSA>ECDSA>Unknown
+// RSA, DSA>ECDSA>Ed25519>Unknown
 func keyAlgoUbiquity(cert *x509.Certificate) KeyAlgoUbiquity {
 	switch cert.PublicKeyAlgorithm {
+	case x509.Ed25519:
+		return Ed25519Ubiquity
 	case x509.ECDSA:
 		switch cert.PublicKey.(*ecdsa.PublicKey).Curve {
 		case elliptic.P256():
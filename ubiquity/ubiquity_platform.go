@@ -106,6 +106,8 @@ func (p Platform) hashUbiquity() HashUbiquity {
 		return SHA1Ubiquity
 	case "SHA2":
 		return SHA2Ubiquity
+	case "RSAPSS":
+		return RSAPSSUbiquity
 	default:
 		return UnknownHashUbiquity
 	}
@@ -121,6 +123,8 @@ func (p Platform) keyAlgoUbiquity() KeyAlgoUbiquity {
 		return ECDSA384Ubiquity
 	case "ECDSA521":
 		return ECDSA521Ubiquity
+	case "Ed25519":
+		return Ed25519Ubiquity
 	default:
 		return UnknownAlgoUbiquity
 	}
@@ -1,6 +1,8 @@
 package ubiquity
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/x509"
 	"io/ioutil"
 	"testing"
@@ -411,3 +413,51 @@ func TestFilterChainKeyAlgoUbiquity(t *testing.T) {
 		t.Fatal("Incorrect chain key algo priority filtering")
 	}
 }
+
+func TestEd25519AndPSSRanking(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519Cert := &x509.Certificate{
+		PublicKeyAlgorithm: x509.Ed25519,
+		PublicKey:          pub,
+		SignatureAlgorithm: x509.PureEd25519,
+	}
+	pssCert := &x509.Certificate{
+		PublicKeyAlgorithm: x509.RSA,
+		PublicKey:          rsa2048Cert.PublicKey,
+		SignatureAlgorithm: x509.SHA256WithRSAPSS,
+	}
+
+	if keyAlgoPriority(ed25519Cert) <= keyAlgoPriority(ecdsa521Cert) {
+		t.Fatal("Ed25519 should have the highest key algorithm priority")
+	}
+	if hashPriority(ed25519Cert) != hashPriority(ecdsa256Cert) || hashPriority(pssCert) != hashPriority(rsa2048Cert) {
+		t.Fatal("Ed25519 and RSA-PSS should have SHA2 hash priority")
+	}
+
+	if keyAlgoUbiquity(ed25519Cert) != Ed25519Ubiquity {
+		t.Fatal("incorrect key algorithm ubiquity")
+	}
+	if keyAlgoUbiquity(ed25519Cert) >= keyAlgoUbiquity(ecdsa521Cert) {
+		t.Fatal("Ed25519 should be less ubiquitous than ECDSA")
+	}
+	if hashUbiquity(pssCert) != RSAPSSUbiquity || hashUbiquity(pssCert) >= hashUbiquity(rsa2048Cert) {
+		t.Fatal("RSA-PSS should be less ubiquitous than PKCS #1 v1.5")
+	}
+
+	platform := Platform{HashAlgo: "SHA2", KeyAlgo: "RSA"}
+	platform.ParseAndLoad()
+	if platform.hashUbiquity() != SHA2Ubiquity {
+		t.Fatal("incorrect platform hash ubiquity")
+	}
+	if ChainHashUbiquity([]*x509.Certificate{pssCert}) >= platform.HashUbiquity {
+		t.Fatal("a SHA2-only platform should not be assumed to support RSA-PSS")
+	}
+	platform = Platform{HashAlgo: "RSAPSS", KeyAlgo: "Ed25519"}
+	platform.ParseAndLoad()
+	if platform.HashUbiquity != RSAPSSUbiquity || platform.KeyAlgoUbiquity != Ed25519Ubiquity {
+		t.Fatal("incorrect platform ubiquity for RSA-PSS and Ed25519")
+	}
+}